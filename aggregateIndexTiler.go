@@ -0,0 +1,219 @@
+package tile
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// AggregateIndexTiler is used for tile coding when multiple IndexTilers must work together, e.g. to combine the
+// tilers for singles and pairs of dimensions into one weight vector. Each IndexTiler is given its own range of
+// indices, which starts after the ranges of the previous IndexTilers.
+type AggregateIndexTiler struct {
+	// tils are the underlying IndexTilers that generate the indices.
+	tils []SizedIndexTiler
+	// offsets contains the amount added to the indices of each IndexTiler.
+	offsets []int
+	// numIndices is the total number of indices of all IndexTilers.
+	numIndices int
+	// ints contains the IndexTilers which provide a TileWithInts method, or nil for the others.
+	ints []intIndexTiler
+	// ignoredInts is set to 1 if TileWithInts ignored the ints of an IndexTiler without a TileWithInts method. It is
+	// accessed atomically because the IndexTilers might be safe for concurrent use.
+	ignoredInts int32
+}
+
+// intIndexTiler is an IndexTiler which can also hash integer inputs, e.g. IndexingTiler.
+type intIndexTiler interface {
+	TileWithInts(data []float64, ints []int) []int
+}
+
+// errIntsIgnored is reported by AggregateIndexTiler.CheckError for an IndexTiler which could not use the ints passed
+// to TileWithInts.
+var errIntsIgnored = errors.New("TileWithInts is not supported, so the ints were ignored")
+
+// NewAggregateIndexTiler creates a new IndexTiler which returns all of the indices provided by the individual
+// IndexTilers. The indices of each IndexTiler are shifted by the total NumIndices of the previous IndexTilers, so the
+// IndexTilers must be created without an offset; an InvalidOptionError is returned if an IndexTiler from this package
+// has an offset. Only the last IndexTiler may have UnlimitedIndices.
+func NewAggregateIndexTiler(tils []SizedIndexTiler) (*AggregateIndexTiler, error) {
+	ait := &AggregateIndexTiler{
+		tils:    tils,
+		offsets: make([]int, len(tils)),
+		ints:    make([]intIndexTiler, len(tils)),
+	}
+	for i, til := range tils {
+		num := til.NumIndices()
+		switch {
+		case num == UnlimitedIndices && i != len(tils)-1:
+			return nil, InvalidMemorySizeError{num, fmt.Sprintf("only the last IndexTiler may be unlimited, not IndexTiler %d", i)}
+		case num < 1:
+			return nil, InvalidMemorySizeError{num, fmt.Sprintf("IndexTiler %d must have at least 1 index", i)}
+		}
+		if offset := indexOffset(til); offset != 0 {
+			return nil, InvalidOptionError{"offset", fmt.Sprintf("IndexTiler %d has offset %d, but it must be 0", i, offset)}
+		}
+		ait.ints[i], _ = til.(intIndexTiler)
+		ait.offsets[i] = ait.numIndices
+		if num == UnlimitedIndices {
+			ait.numIndices = UnlimitedIndices
+		} else {
+			ait.numIndices += num
+		}
+	}
+	return ait, nil
+}
+
+// Tile returns a vector of indices describing the input data.
+func (ait *AggregateIndexTiler) Tile(data []float64) []int {
+	return ait.TileInto(nil, data)
+}
+
+// TileInto is like Tile, but the indices are written into dst if its capacity is large enough. IndexTilers which
+// provide a TileInto method (e.g. IndexingTiler) write directly into dst.
+func (ait *AggregateIndexTiler) TileInto(dst []int, data []float64) []int {
+	output := dst[:0]
+	for i, til := range ait.tils {
+		start := len(output)
+		if it, ok := til.(interface {
+			TileInto(dst []int, data []float64) []int
+		}); ok {
+			// If it reuses the remaining capacity of output, this append copies the indices onto themselves.
+			output = append(output, it.TileInto(output[start:], data)...)
+		} else {
+			output = append(output, til.Tile(data)...)
+		}
+		ait.shift(output[start:], i)
+	}
+	return output
+}
+
+// TileWithInts is like Tile, but the ints are also hashed without being tiled. See IntTiler for details. Every
+// IndexTiler in this package supports it. The indices of any other IndexTiler without a TileWithInts method are
+// calculated by Tile, so they don't depend on the ints, and CheckError reports an error for that IndexTiler.
+func (ait *AggregateIndexTiler) TileWithInts(data []float64, ints []int) []int {
+	output := []int{}
+	for i, til := range ait.tils {
+		start := len(output)
+		if it := ait.ints[i]; it != nil {
+			output = append(output, it.TileWithInts(data, ints)...)
+		} else {
+			output = append(output, til.Tile(data)...)
+			if len(ints) > 0 {
+				atomic.StoreInt32(&ait.ignoredInts, 1)
+			}
+		}
+		ait.shift(output[start:], i)
+	}
+	return output
+}
+
+// shift adds the offset of IndexTiler i to each of its indices. Negative indices (e.g. the unknown index of a frozen
+// IndexingTiler) are not changed.
+func (ait *AggregateIndexTiler) shift(indices []int, i int) {
+	offset := ait.offsets[i]
+	if offset == 0 {
+		return
+	}
+	for j, idx := range indices {
+		if idx >= 0 {
+			indices[j] = idx + offset
+		}
+	}
+}
+
+// indexOffset returns the offset of an IndexTiler from this package, or 0 for any other IndexTiler.
+func indexOffset(til SizedIndexTiler) int {
+	switch til := til.(type) {
+	case *IndexingTiler:
+		return til.alloc.offset
+	case *ConcurrentIndexingTiler:
+		return til.offset
+	case *ModuloTiler:
+		return til.offset
+	case *CollisionTable:
+		return til.offset
+	default:
+		return 0
+	}
+}
+
+// NumIndices returns the total number of indices used by all of the IndexTilers, which is the number of features (e.g.
+// the length of the weight vector). It is UnlimitedIndices if the last IndexTiler is unlimited.
+func (ait *AggregateIndexTiler) NumIndices() int {
+	return ait.numIndices
+}
+
+// Offset returns the first index of the range used by IndexTiler i, so its indices are in the range
+// [Offset(i), Offset(i)+NumIndices).
+func (ait *AggregateIndexTiler) Offset(i int) int {
+	return ait.offsets[i]
+}
+
+// AggregateIndexError is returned by AggregateIndexTiler.CheckError if any of the IndexTilers has an error.
+type AggregateIndexError struct {
+	// Errors contains the error of each IndexTiler, or nil if it has no error.
+	Errors []error
+}
+
+func (err AggregateIndexError) Error() string {
+	msgs := []string{}
+	for i, e := range err.Errors {
+		if e != nil {
+			msgs = append(msgs, fmt.Sprintf("IndexTiler %d: %s", i, e.Error()))
+		}
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Is returns true if any of the errors matches the target, so errors.Is can find them.
+func (err AggregateIndexError) Is(target error) bool {
+	for _, e := range err.Errors {
+		if e != nil && errors.Is(e, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first error which matches the target, so errors.As can find them.
+func (err AggregateIndexError) As(target interface{}) bool {
+	for _, e := range err.Errors {
+		if e != nil && errors.As(e, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckError returns an AggregateIndexError if any of the IndexTilers has an error, or if TileWithInts ignored the ints
+// of an IndexTiler which doesn't support them.
+func (ait *AggregateIndexTiler) CheckError() error {
+	errs := make([]error, len(ait.tils))
+	failed := false
+	ignoredInts := atomic.LoadInt32(&ait.ignoredInts) != 0
+	for i, til := range ait.tils {
+		errs[i] = til.CheckError()
+		if errs[i] == nil && ignoredInts && ait.ints[i] == nil {
+			errs[i] = errIntsIgnored
+		}
+		failed = failed || errs[i] != nil
+	}
+	if !failed {
+		return nil
+	}
+	return AggregateIndexError{errs}
+}
+
+// ClearError clears the error returned by CheckError by calling ClearError on each IndexTiler which provides it (e.g.
+// IndexingTiler), and by forgetting any ints ignored by TileWithInts. Errors of the other IndexTilers (e.g. a full
+// CollisionTable) are still reported.
+func (ait *AggregateIndexTiler) ClearError() {
+	atomic.StoreInt32(&ait.ignoredInts, 0)
+	for _, til := range ait.tils {
+		if ct, ok := til.(interface{ ClearError() }); ok {
+			ct.ClearError()
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package tile
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var _ = SizedIndexTiler(&AggregateIndexTiler{}) // Conform to interface
+
+func TestAggregateIndexTilerDisjointRanges(t *testing.T) {
+	singles, _ := NewSinglesTiler(2, 4)
+	pairs, _ := NewPairsTiler(2, 4)
+	singlesIt, err := NewIndexingTiler(singles, 1000)
+	require.NoError(t, err)
+	pairsIt, err := NewIndexingTiler(pairs, 1000)
+	require.NoError(t, err)
+	mt, err := NewModuloTiler(pairs, 7)
+	require.NoError(t, err)
+
+	ait, err := NewAggregateIndexTiler([]SizedIndexTiler{singlesIt, pairsIt, mt})
+	require.NoError(t, err)
+	assert.Equal(t, 2007, ait.NumIndices())
+	assert.Equal(t, []int{0, 1000, 2000}, []int{ait.Offset(0), ait.Offset(1), ait.Offset(2)})
+
+	for i := 0; i < 20; i++ {
+		indices := ait.Tile(makeValues(2))
+		require.Len(t, indices, 16)
+		for j, idx := range indices {
+			switch {
+			case j < 8:
+				assert.True(t, idx >= 0 && idx < 1000, "singles index %d", idx)
+			case j < 12:
+				assert.True(t, idx >= 1000 && idx < 2000, "pairs index %d", idx)
+			default:
+				assert.True(t, idx >= 2000 && idx < 2007, "modulo index %d", idx)
+			}
+		}
+	}
+	assert.NoError(t, ait.CheckError())
+}
+
+func TestAggregateIndexTilerMatchesOffsets(t *testing.T) {
+	til1, _ := NewHashTiler(4, WithSeed(1))
+	til2, _ := NewHashTiler(2, WithSeed(2))
+	it1, _ := NewIndexingTiler(til1, 10)
+	it2, _ := NewIndexingTiler(til2, UnlimitedIndices)
+	ait, err := NewAggregateIndexTiler([]SizedIndexTiler{it1, it2})
+	require.NoError(t, err)
+	assert.Equal(t, UnlimitedIndices, ait.NumIndices())
+
+	// This is the same as calculating the offsets by hand.
+	manual1, _ := NewIndexingTiler(til1, 10)
+	manual2, _ := NewIndexingTilerWithOffset(til2, 10, UnlimitedIndices)
+	for i := 0; i < 10; i++ {
+		data := makeValues(2)
+		assert.Equal(t, append(manual1.Tile(data), manual2.Tile(data)...), ait.Tile(data))
+		assert.Equal(t, append(manual1.TileWithInts(data, []int{i}), manual2.TileWithInts(data, []int{i})...), ait.TileWithInts(data, []int{i}))
+	}
+
+	dst := make([]int, 6)
+	data := makeValues(2)
+	assert.Equal(t, ait.Tile(data), ait.TileInto(dst, data))
+	assert.Equal(t, ait.Tile(data), dst, "TileInto should reuse dst")
+}
+
+func TestAggregateIndexTilerKeepsUnknownIndex(t *testing.T) {
+	it1, _ := NewIndexingTiler(identityTiler{}, 5)
+	it2, _ := NewIndexingTiler(identityTiler{}, 5)
+	ait, err := NewAggregateIndexTiler([]SizedIndexTiler{it1, it2})
+	require.NoError(t, err)
+
+	assert.Equal(t, []int{0, 5}, ait.Tile([]float64{1}))
+	it2.Freeze(-1)
+	assert.Equal(t, []int{1, -1}, ait.Tile([]float64{2}), "the unknown index should not be shifted")
+}
+
+func TestAggregateIndexTilerCombinesErrors(t *testing.T) {
+	it1, _ := NewIndexingTiler(identityTiler{}, 5)
+	it2, _ := NewIndexingTiler(identityTiler{}, 1)
+	ct, _ := NewCollisionTable(identityTiler{}, 1, SafeCollisions)
+	ait, err := NewAggregateIndexTiler([]SizedIndexTiler{it1, it2, ct})
+	require.NoError(t, err)
+
+	ait.Tile([]float64{1})
+	assert.NoError(t, ait.CheckError())
+	ait.Tile([]float64{2})
+
+	err = ait.CheckError()
+	var aggErr AggregateIndexError
+	require.True(t, errors.As(err, &aggErr))
+	require.Len(t, aggErr.Errors, 3)
+	assert.NoError(t, aggErr.Errors[0])
+	assert.IsType(t, IndexOverflowError{}, aggErr.Errors[1])
+	assert.IsType(t, CollisionTableFullError{}, aggErr.Errors[2])
+	assert.Contains(t, err.Error(), "IndexTiler 1")
+	assert.Contains(t, err.Error(), "IndexTiler 2")
+	assert.NotContains(t, err.Error(), "IndexTiler 0")
+
+	// The errors of the IndexTilers can be found directly.
+	var overflow IndexOverflowError
+	require.True(t, errors.As(err, &overflow))
+	assert.Equal(t, aggErr.Errors[1], overflow)
+	var full CollisionTableFullError
+	assert.True(t, errors.As(err, &full))
+	assert.True(t, errors.Is(err, aggErr.Errors[2]))
+	assert.False(t, errors.Is(err, errIntsIgnored))
+}
+
+// plainIndexTiler hides every method of a SizedIndexTiler except those in the interface.
+type plainIndexTiler struct {
+	SizedIndexTiler
+}
+
+func TestAggregateIndexTilerWithoutTileWithInts(t *testing.T) {
+	it1, _ := NewIndexingTiler(identityTiler{}, 5)
+	it2, _ := NewIndexingTiler(identityTiler{}, 5)
+	ait, err := NewAggregateIndexTiler([]SizedIndexTiler{it1, plainIndexTiler{it2}})
+	require.NoError(t, err)
+
+	assert.Equal(t, []int{0, 5}, ait.TileWithInts([]float64{1}, nil))
+	assert.NoError(t, ait.CheckError(), "no ints were ignored")
+
+	indices := ait.TileWithInts([]float64{1}, []int{3})
+	assert.NotEqual(t, 0, indices[0], "the ints should be used by the first IndexTiler")
+	assert.Equal(t, 5, indices[1], "the second IndexTiler should fall back to Tile")
+	err = ait.CheckError()
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, errIntsIgnored))
+	assert.Contains(t, err.Error(), "IndexTiler 1")
+	assert.NotContains(t, err.Error(), "IndexTiler 0")
+
+	ait.ClearError()
+	assert.NoError(t, ait.CheckError())
+}
+
+func TestAggregateIndexTilerClearError(t *testing.T) {
+	it, _ := NewIndexingTiler(identityTiler{}, 1)
+	cit, _ := NewConcurrentIndexingTiler(identityTiler{}, 1)
+	ct, _ := NewCollisionTable(identityTiler{}, 1, SafeCollisions)
+	ait, err := NewAggregateIndexTiler([]SizedIndexTiler{it, cit})
+	require.NoError(t, err)
+
+	ait.Tile([]float64{1, 2})
+	require.Error(t, ait.CheckError())
+	ait.ClearError()
+	assert.NoError(t, ait.CheckError())
+	assert.NoError(t, it.CheckError())
+	assert.NoError(t, cit.CheckError())
+
+	// A CollisionTable can't clear its error, so it is still reported.
+	ait, err = NewAggregateIndexTiler([]SizedIndexTiler{it, ct})
+	require.NoError(t, err)
+	ait.Tile([]float64{3, 4})
+	ait.ClearError()
+	err = ait.CheckError()
+	var full CollisionTableFullError
+	assert.True(t, errors.As(err, &full))
+	var overflow IndexOverflowError
+	assert.False(t, errors.As(err, &overflow))
+}
+
+func TestAggregateIndexTilerRejectsOffsets(t *testing.T) {
+	it, _ := NewIndexingTiler(identityTiler{}, 5)
+	withOffset, _ := NewIndexingTilerWithOffset(identityTiler{}, 3, 5)
+	cit, _ := NewConcurrentIndexingTilerWithOffset(identityTiler{}, 3, 5)
+	mt, _ := NewModuloTilerWithOffset(identityTiler{}, 3, 5)
+	ct, _ := NewCollisionTableWithOffset(identityTiler{}, 3, 5, SafeCollisions)
+	tests := map[string]SizedIndexTiler{
+		"IndexingTiler":           withOffset,
+		"ConcurrentIndexingTiler": cit,
+		"ModuloTiler":             mt,
+		"CollisionTable":          ct,
+	}
+
+	for name, til := range tests {
+		t.Run(name, func(t *testing.T) {
+			ait, err := NewAggregateIndexTiler([]SizedIndexTiler{it, til})
+			assert.IsType(t, InvalidOptionError{}, err)
+			assert.Nil(t, ait)
+		})
+	}
+}
+
+// emptyIndexTiler is a SizedIndexTiler without any indices, which the IndexTilers in this package don't allow.
+type emptyIndexTiler struct{}
+
+func (emptyIndexTiler) Tile(data []float64) []int {
+	return []int{}
+}
+
+func (emptyIndexTiler) CheckError() error {
+	return nil
+}
+
+func (emptyIndexTiler) NumIndices() int {
+	return 0
+}
+
+func TestAggregateIndexTilerInvalidSizes(t *testing.T) {
+	unlimited, _ := NewIndexingTiler(identityTiler{}, UnlimitedIndices)
+	limited, _ := NewIndexingTiler(identityTiler{}, 3)
+	tests := map[string][]SizedIndexTiler{
+		"Unlimited first": {unlimited, limited},
+		"Empty":           {limited, emptyIndexTiler{}},
+	}
+
+	for name, tils := range tests {
+		t.Run(name, func(t *testing.T) {
+			ait, err := NewAggregateIndexTiler(tils)
+			assert.IsType(t, InvalidMemorySizeError{}, err)
+			assert.Nil(t, ait)
+		})
+	}
+}
@@ -1,84 +1,540 @@
 package tile
 
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
 // AggregateTiler is used for tile coding when multiple Tilers must work together.
 type AggregateTiler struct {
 	// tils are the underlying Tilers that generate the hashes.
 	tils []Tiler
+
+	// workers is the maximum number of goroutines used to run the Tilers. If it's 1, they are run serially.
+	workers int
+	// layout stores the *aggregateLayout found by the most recent serial run, which is used to run Tilers in parallel.
+	layout atomic.Value
+}
+
+// aggregateLayout describes where the output of each Tiler is written in the output of an AggregateTiler. The output
+// of Tiler i is at [offsets[i], offsets[i+1]).
+type aggregateLayout struct {
+	offsets []int
+}
+
+// AggregateTilerOption configures optional behavior of an AggregateTiler. Options are provided to NewAggregateTiler or
+// NewSubsetsTiler, or to the other subset constructors with WithAggregateOptions.
+type AggregateTilerOption func(*AggregateTiler) error
+
+// WithWorkers runs the underlying Tilers in parallel on up to the provided number of goroutines, which is useful when
+// there are many Tilers (e.g. NewPairsTiler with many dimensions; see WithAggregateOptions). The output is the same as
+// when they are run serially. The Tilers must be safe to run concurrently with each other, which is true of the Tilers
+// in this package. The first call (and any call where a Tiler returns a different number of hashes than before) is run
+// serially to find where each Tiler's hashes belong in the output.
+func WithWorkers(workers int) AggregateTilerOption {
+	return func(til *AggregateTiler) error {
+		if workers < 1 {
+			return InvalidOptionError{"WithWorkers", fmt.Sprintf("there must be at least 1 worker, not %d", workers)}
+		}
+		til.workers = workers
+		return nil
+	}
 }
 
 // NewAggregateTiler creates a new Tiler which returns all of the hashes provided
 // by the individual Tilers.
-func NewAggregateTiler(tils []Tiler) (*AggregateTiler, error) {
-	return &AggregateTiler{
-		tils: tils,
-	}, nil
+func NewAggregateTiler(tils []Tiler, opts ...AggregateTilerOption) (*AggregateTiler, error) {
+	til := &AggregateTiler{
+		tils:    tils,
+		workers: 1,
+	}
+	for _, opt := range opts {
+		if err := opt(til); err != nil {
+			return nil, err
+		}
+	}
+	return til, nil
+}
+
+// Tilers returns the underlying Tilers, e.g. so they can be combined with other Tilers in a new AggregateTiler.
+func (til *AggregateTiler) Tilers() []Tiler {
+	return append([]Tiler(nil), til.tils...)
 }
 
 // Tile returns a vector of indices describing the input data.
 func (til *AggregateTiler) Tile(data []float64) []uint64 {
-	output := []uint64{}
+	return til.TileInto(nil, data)
+}
 
-	for _, til := range til.tils {
-		output = append(output, til.Tile(data)...)
+// TileInto is like Tile, but the hashes are written into dst if its capacity is large enough. Tilers which implement
+// IntoTiler write directly into dst, so no allocation is needed for them.
+func (til *AggregateTiler) TileInto(dst []uint64, data []float64) []uint64 {
+	if til.workers > 1 {
+		return til.tile(dst, func(child Tiler, dst []uint64) []uint64 {
+			return tileInto(child, dst, data)
+		})
+	}
+
+	// This is the same as tileSerial, but without a closure, so it doesn't allocate.
+	output := dst[:0]
+	for _, child := range til.tils {
+		// If child reuses the remaining capacity of output, this append copies the hashes onto themselves.
+		output = append(output, tileInto(child, output[len(output):], data)...)
+	}
+	return output
+}
+
+// TileWithInts is like Tile, but the ints are also hashed without being tiled. See IntTiler for details. Tilers which
+// are not IntTilers have the ints mixed into each of their hashes instead.
+func (til *AggregateTiler) TileWithInts(data []float64, ints []int) []uint64 {
+	return til.tile(nil, func(child Tiler, dst []uint64) []uint64 {
+		return tileWithInts(child, data, ints)
+	})
+}
+
+// tile calls tileChild for each of the Tilers, and writes their hashes into dst in order. The dst provided to
+// tileChild can be used to store the hashes if its capacity is large enough.
+func (til *AggregateTiler) tile(dst []uint64, tileChild func(child Tiler, dst []uint64) []uint64) []uint64 {
+	if til.workers > 1 && len(til.tils) > 1 {
+		if layout, ok := til.layout.Load().(*aggregateLayout); ok {
+			if output, ok := til.tileParallel(dst, layout, tileChild); ok {
+				return output
+			}
+		}
+		return til.tileSerial(dst, tileChild, true)
+	}
+	return til.tileSerial(dst, tileChild, false)
+}
+
+// tileSerial runs each Tiler in order. If record is true, the layout of the output is stored for tileParallel.
+func (til *AggregateTiler) tileSerial(dst []uint64, tileChild func(child Tiler, dst []uint64) []uint64, record bool) []uint64 {
+	output := dst[:0]
+	var offsets []int
+	if record {
+		offsets = make([]int, len(til.tils)+1)
 	}
 
+	for i, child := range til.tils {
+		// If child reuses the remaining capacity of output, this append copies the hashes onto themselves.
+		output = append(output, tileChild(child, output[len(output):])...)
+		if record {
+			offsets[i+1] = len(output)
+		}
+	}
+
+	if record {
+		til.layout.Store(&aggregateLayout{offsets})
+	}
 	return output
 }
 
-// singleTiler is used for tile coding when multiple Tilers must work together.
-type singleTiler struct {
-	idx int
-	til Tiler
+// tileParallel runs the Tilers on up to til.workers goroutines, writing each Tiler's hashes where the layout says they
+// belong. It returns false if any Tiler returned a different number of hashes than expected.
+func (til *AggregateTiler) tileParallel(dst []uint64, layout *aggregateLayout, tileChild func(child Tiler, dst []uint64) []uint64) ([]uint64, bool) {
+	if len(layout.offsets) != len(til.tils)+1 {
+		// The layout is not for these Tilers, e.g. because they were replaced by UnmarshalJSON.
+		return nil, false
+	}
+	total := layout.offsets[len(til.tils)]
+	if cap(dst) < total {
+		dst = make([]uint64, total)
+	}
+	output := dst[:total]
+
+	workers := til.workers
+	if workers > len(til.tils) {
+		workers = len(til.tils)
+	}
+	next := int64(-1)
+	mismatch := int32(0)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(atomic.AddInt64(&next, 1))
+				if i >= len(til.tils) {
+					return
+				}
+				start, end := layout.offsets[i], layout.offsets[i+1]
+				// The capacity is limited so the Tiler can't write into the output of the next Tiler.
+				hashes := tileChild(til.tils[i], output[start:end:end])
+				if len(hashes) != end-start {
+					atomic.StoreInt32(&mismatch, 1)
+					continue
+				}
+				copy(output[start:end], hashes)
+			}
+		}()
+	}
+	wg.Wait()
+
+	return output, atomic.LoadInt32(&mismatch) == 0
+}
+
+// Coordinates returns the coordinates of the tile which produced the hash, if any of the underlying Tilers is a
+// CoordinateTiler that recorded it.
+func (til *AggregateTiler) Coordinates(hash uint64) (TileCoordinates, bool) {
+	for _, til := range til.tils {
+		if ct, ok := til.(CoordinateTiler); ok {
+			if tc, ok := ct.Coordinates(hash); ok {
+				return tc, true
+			}
+		}
+	}
+	return TileCoordinates{}, false
+}
+
+// Subset describes a group of input dimensions which are tiled together, and the number of tilings to use for them.
+type Subset struct {
+	Dims       []int
+	NumTilings int
+	// Widths contains the tile width for each of the dimensions in Dims. If it is nil, every width is 1.
+	Widths []float64
 }
 
-func (til *singleTiler) Tile(data []float64) []uint64 {
-	return til.til.Tile([]float64{data[til.idx]})
+// InvalidSubsetError is returned when the dimensions of a Subset are invalid.
+type InvalidSubsetError struct {
+	Dims   []int
+	Reason string
+}
+
+func (err InvalidSubsetError) Error() string {
+	return fmt.Sprintf("invalid subset %v: %s", err.Dims, err.Reason)
+}
+
+// validateDims returns an InvalidSubsetError if dims is empty or contains negative or repeated dimensions.
+func validateDims(dims []int) error {
+	if len(dims) == 0 {
+		return InvalidSubsetError{dims, "must contain at least 1 dimension"}
+	}
+	for i, dim := range dims {
+		if dim < 0 {
+			return InvalidSubsetError{dims, fmt.Sprintf("dimension %d is negative", dim)}
+		}
+		for _, other := range dims[:i] {
+			if dim == other {
+				return InvalidSubsetError{dims, fmt.Sprintf("dimension %d is repeated", dim)}
+			}
+		}
+	}
+	return nil
 }
 
-// NewSinglesTiler creates a new Tiler which tiles each dimension individually.
-func NewSinglesTiler(numDims, numTilings int) (*AggregateTiler, error) {
-	tils := make([]Tiler, numDims)
-	for i := range tils {
-		til, err := NewHashTiler(numTilings)
+// NewSubsetsTiler creates a new Tiler which tiles each subset of the input dimensions separately, e.g. the subsets
+// [0], [1 2], and [0 1 3]. Dimensions which are tiled together generalize together, so the choice of subsets controls
+// how the learned function generalizes. Each subset is tiled by its own HashTiler with Subset.NumTilings tilings.
+// Options such as WithWorkers are applied to the returned AggregateTiler.
+func NewSubsetsTiler(subsets []Subset, opts ...AggregateTilerOption) (*AggregateTiler, error) {
+	tils := make([]Tiler, len(subsets))
+	for i, subset := range subsets {
+		if err := validateDims(subset.Dims); err != nil {
+			return nil, err
+		}
+		opts := []HashTilerOption{}
+		if subset.Widths != nil {
+			if len(subset.Widths) != len(subset.Dims) {
+				return nil, InvalidSubsetError{subset.Dims, fmt.Sprintf("has %d widths for %d dimensions", len(subset.Widths), len(subset.Dims))}
+			}
+			opts = append(opts, WithTileWidths(subset.Widths))
+		}
+		til, err := NewHashTiler(subset.NumTilings, opts...)
 		if err != nil {
 			return nil, err
 		}
-		tils[i] = &singleTiler{
-			idx: i,
-			til: til,
+		tils[i] = newSubsetTiler(append([]int(nil), subset.Dims...), til)
+	}
+	return NewAggregateTiler(tils, opts...)
+}
+
+// KSubsets returns every subset of k dimensions from numDims dimensions, in lexicographic order, each with numTilings
+// tilings. For example, k=2 returns every pair of dimensions.
+func KSubsets(numDims, k, numTilings int) []Subset {
+	subsets := []Subset{}
+	if k < 1 || k > numDims {
+		return subsets
+	}
+	dims := make([]int, k)
+	for i := range dims {
+		dims[i] = i
+	}
+	for {
+		subsets = append(subsets, Subset{Dims: append([]int(nil), dims...), NumTilings: numTilings})
+
+		// Find the last dimension which can be increased, then reset the following dimensions to follow it.
+		i := k - 1
+		for i >= 0 && dims[i] == numDims-k+i {
+			i--
+		}
+		if i < 0 {
+			return subsets
+		}
+		dims[i]++
+		for j := i + 1; j < k; j++ {
+			dims[j] = dims[j-1] + 1
 		}
 	}
-	return NewAggregateTiler(tils)
 }
 
-// pairTiler is used for tile coding when multiple Tilers must work together.
-type pairTiler struct {
-	idx1, idx2 int
-	til        Tiler
+// SubsetOption changes the subsets created by NewSinglesTiler, NewPairsTiler, NewKSubsetsTiler, and
+// NewSinglesPairsJointTiler before they are tiled, or the AggregateTiler which tiles them.
+type SubsetOption func(*subsetConfig) error
+
+// subsetConfig contains the arguments which SubsetOptions provide to NewSubsetsTiler.
+type subsetConfig struct {
+	subsets []Subset
+	opts    []AggregateTilerOption
 }
 
-func (til *pairTiler) Tile(data []float64) []uint64 {
-	return til.til.Tile([]float64{data[til.idx1], data[til.idx2]})
+// WithSubsetTilings sets the number of tilings of each subset, in the order they are created: by dimension for
+// NewSinglesTiler, and in the order of KSubsets for NewPairsTiler and NewKSubsetsTiler. For example, the pairs of 3
+// dimensions are [0 1], [0 2], and [1 2].
+func WithSubsetTilings(numTilings []int) SubsetOption {
+	return func(cfg *subsetConfig) error {
+		if len(numTilings) != len(cfg.subsets) {
+			return InvalidOptionError{"WithSubsetTilings", fmt.Sprintf("%d tilings were provided for %d subsets", len(numTilings), len(cfg.subsets))}
+		}
+		for i := range cfg.subsets {
+			cfg.subsets[i].NumTilings = numTilings[i]
+		}
+		return nil
+	}
 }
 
-// NewPairsTiler creates a new Tiler which tiles each pair of dimensions.
-func NewPairsTiler(numDims, numTilings int) (*AggregateTiler, error) {
-	numTilers := numDims * (numDims - 1) / 2
-	tilerIndex := 0
-	tils := make([]Tiler, numTilers)
-	for i := 0; i < numDims; i++ {
-		for j := i + 1; j < numDims; j++ {
-			til, err := NewHashTiler(numTilings)
-			if err != nil {
-				return nil, err
-			}
-			tils[tilerIndex] = &pairTiler{
-				idx1: i,
-				idx2: j,
-				til:  til,
+// WithDimWidths sets the tile width of each input dimension. Every subset containing the dimension uses the width.
+func WithDimWidths(widths []float64) SubsetOption {
+	return func(cfg *subsetConfig) error {
+		for i := range cfg.subsets {
+			subsetWidths := make([]float64, len(cfg.subsets[i].Dims))
+			for j, dim := range cfg.subsets[i].Dims {
+				if dim >= len(widths) {
+					return InvalidOptionError{"WithDimWidths", fmt.Sprintf("there is no width for dimension %d", dim)}
+				}
+				subsetWidths[j] = widths[dim]
 			}
-			tilerIndex++
+			cfg.subsets[i].Widths = subsetWidths
+		}
+		return nil
+	}
+}
+
+// WithSubsetWidths sets the tile widths of each subset, in the same order as WithSubsetTilings. Each subset has a
+// width for each of its dimensions, so e.g. a pair can be tiled more coarsely than the singles with the same
+// dimensions.
+func WithSubsetWidths(widths [][]float64) SubsetOption {
+	return func(cfg *subsetConfig) error {
+		if len(widths) != len(cfg.subsets) {
+			return InvalidOptionError{"WithSubsetWidths", fmt.Sprintf("%d widths were provided for %d subsets", len(widths), len(cfg.subsets))}
+		}
+		for i := range cfg.subsets {
+			cfg.subsets[i].Widths = append([]float64(nil), widths[i]...)
+		}
+		return nil
+	}
+}
+
+// WithAggregateOptions provides options such as WithWorkers to the AggregateTiler which tiles the subsets. For
+// example, WithAggregateOptions(WithWorkers(4)) tiles the pairs from NewPairsTiler on up to 4 goroutines.
+func WithAggregateOptions(opts ...AggregateTilerOption) SubsetOption {
+	return func(cfg *subsetConfig) error {
+		cfg.opts = append(cfg.opts, opts...)
+		return nil
+	}
+}
+
+// NewSinglesTiler creates a new Tiler which tiles each dimension individually. Options can set different tilings and
+// widths for each dimension.
+func NewSinglesTiler(numDims, numTilings int, opts ...SubsetOption) (*AggregateTiler, error) {
+	return NewKSubsetsTiler(numDims, 1, numTilings, opts...)
+}
+
+// NewPairsTiler creates a new Tiler which tiles each pair of dimensions. Options can set different tilings and widths
+// for each pair.
+func NewPairsTiler(numDims, numTilings int, opts ...SubsetOption) (*AggregateTiler, error) {
+	return NewKSubsetsTiler(numDims, 2, numTilings, opts...)
+}
+
+// NewKSubsetsTiler creates a new Tiler which tiles each subset of k dimensions, e.g. every triple of dimensions if k
+// is 3. There are numDims choose k subsets, so this can be a very large number of tilings for large k.
+func NewKSubsetsTiler(numDims, k, numTilings int, opts ...SubsetOption) (*AggregateTiler, error) {
+	return newSubsetsTiler(KSubsets(numDims, k, numTilings), opts)
+}
+
+// NewSinglesPairsJointTiler creates a new Tiler which tiles each dimension individually, each pair of dimensions, and
+// all of the dimensions jointly. This combines broad generalization along each dimension with the fine discrimination
+// of the full joint tiling. Subsets are not repeated, so if numDims is 2 the only pair is the joint tiling. Options
+// apply to the singles, then the pairs, then the joint tiling.
+func NewSinglesPairsJointTiler(numDims, numTilings int, opts ...SubsetOption) (*AggregateTiler, error) {
+	subsets := append(KSubsets(numDims, 1, numTilings), KSubsets(numDims, 2, numTilings)...)
+	if numDims > 2 {
+		subsets = append(subsets, KSubsets(numDims, numDims, numTilings)...)
+	}
+	return newSubsetsTiler(subsets, opts)
+}
+
+func newSubsetsTiler(subsets []Subset, opts []SubsetOption) (*AggregateTiler, error) {
+	cfg := subsetConfig{subsets: subsets}
+	for _, opt := range opts {
+		if err := opt(&cfg); err != nil {
+			return nil, err
 		}
 	}
-	return NewAggregateTiler(tils)
+	return NewSubsetsTiler(cfg.subsets, cfg.opts...)
+}
+
+// tilerState is the serialized form of a Tiler in a tree of AggregateTilers. Type determines which fields are used.
+type tilerState struct {
+	Type string `json:"type"`
+	// Hash is used for a HashTiler.
+	Hash *hashTilerState `json:"hash,omitempty"`
+	// Tilers are the children of an AggregateTiler.
+	Tilers []tilerState `json:"tilers,omitempty"`
+	// Dims are the input dimensions used by Tiler for a Tiler which only tiles some dimensions (e.g. those created by
+	// NewSubsetsTiler).
+	Dims  []int       `json:"dims,omitempty"`
+	Tiler *tilerState `json:"tiler,omitempty"`
+}
+
+const (
+	hashTilerType      = "hash"
+	aggregateTilerType = "aggregate"
+	subsetTilerType    = "subset"
+)
+
+// stateOf returns the serialized form of til. Only the Tilers provided by this package can be serialized.
+func stateOf(til Tiler) (tilerState, error) {
+	switch til := til.(type) {
+	case *HashTiler:
+		st := til.state()
+		return tilerState{Type: hashTilerType, Hash: &st}, nil
+	case *AggregateTiler:
+		return til.state()
+	case *SubsetTiler:
+		return subsetState(til.dims, til.til)
+	default:
+		return tilerState{}, fmt.Errorf("cannot serialize Tiler of type %T", til)
+	}
+}
+
+func subsetState(dims []int, til Tiler) (tilerState, error) {
+	st, err := stateOf(til)
+	if err != nil {
+		return tilerState{}, err
+	}
+	return tilerState{Type: subsetTilerType, Dims: dims, Tiler: &st}, nil
+}
+
+// tiler creates the Tiler described by the state.
+func (st tilerState) tiler() (Tiler, error) {
+	switch st.Type {
+	case hashTilerType:
+		if st.Hash == nil {
+			return nil, fmt.Errorf("%s tiler has no configuration", st.Type)
+		}
+		ht := &HashTiler{}
+		if err := ht.setState(*st.Hash); err != nil {
+			return nil, err
+		}
+		return ht, nil
+	case aggregateTilerType:
+		til := &AggregateTiler{workers: 1}
+		if err := til.setState(st); err != nil {
+			return nil, err
+		}
+		return til, nil
+	case subsetTilerType:
+		if st.Tiler == nil {
+			return nil, fmt.Errorf("%s tiler has no underlying tiler", st.Type)
+		}
+		if err := validateDims(st.Dims); err != nil {
+			return nil, err
+		}
+		til, err := st.Tiler.tiler()
+		if err != nil {
+			return nil, err
+		}
+		return newSubsetTiler(st.Dims, til), nil
+	default:
+		return nil, fmt.Errorf("unknown tiler type %q", st.Type)
+	}
+}
+
+func (til *AggregateTiler) state() (tilerState, error) {
+	st := tilerState{Type: aggregateTilerType, Tilers: make([]tilerState, len(til.tils))}
+	for i, child := range til.tils {
+		var err error
+		if st.Tilers[i], err = stateOf(child); err != nil {
+			return tilerState{}, err
+		}
+	}
+	return st, nil
+}
+
+func (til *AggregateTiler) setState(st tilerState) error {
+	if st.Type != aggregateTilerType {
+		return fmt.Errorf("cannot restore %s tiler as an AggregateTiler", st.Type)
+	}
+	tils := make([]Tiler, len(st.Tilers))
+	for i, child := range st.Tilers {
+		var err error
+		if tils[i], err = child.tiler(); err != nil {
+			return err
+		}
+	}
+	til.tils = tils
+	if til.workers < 1 {
+		til.workers = 1
+	}
+	// The layout of the previous Tilers is no longer valid.
+	til.layout.Store(&aggregateLayout{})
+	return nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler. It stores the configuration of every underlying Tiler, including
+// their seeds, so the restored AggregateTiler returns the same hashes. It returns an error if any of the underlying
+// Tilers is not a HashTiler, AggregateTiler, or part of a Tiler created by NewSubsetsTiler (or the constructors which
+// use it, like NewSinglesTiler and NewPairsTiler). WithWorkers is not stored, so the Tilers are run serially unless the
+// AggregateTiler which is restored was created with WithWorkers.
+func (til *AggregateTiler) MarshalBinary() ([]byte, error) {
+	st, err := til.state()
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(st); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler. It restores the AggregateTiler saved by MarshalBinary.
+func (til *AggregateTiler) UnmarshalBinary(data []byte) error {
+	var st tilerState
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&st); err != nil {
+		return err
+	}
+	return til.setState(st)
+}
+
+// MarshalJSON implements json.Marshaler. It stores the same configuration as MarshalBinary.
+func (til *AggregateTiler) MarshalJSON() ([]byte, error) {
+	st, err := til.state()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(st)
+}
+
+// UnmarshalJSON implements json.Unmarshaler. It restores the AggregateTiler saved by MarshalJSON.
+func (til *AggregateTiler) UnmarshalJSON(data []byte) error {
+	var st tilerState
+	if err := json.Unmarshal(data, &st); err != nil {
+		return err
+	}
+	return til.setState(st)
 }
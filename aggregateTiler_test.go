@@ -2,13 +2,16 @@ package tile
 
 import (
 	"fmt"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
-var _ = Tiler(&AggregateTiler{}) // Conform to interface
+var _ = IntoTiler(&AggregateTiler{})       // Conform to interface
+var _ = IntTiler(&AggregateTiler{})        // Conform to interface
+var _ = CoordinateTiler(&AggregateTiler{}) // Conform to interface
 
 func newAggregateTiler() (Tiler, error) {
 	til1, _ := NewHashTiler(4)
@@ -80,3 +83,418 @@ func TestComplexAggregateTiler(t *testing.T) {
 		assert.Equal(t, i, resI)
 	}
 }
+
+func TestAggregateTilerTileIntoMatchesTile(t *testing.T) {
+	til, err := NewPairsTiler(4, 4)
+	require.NoError(t, err)
+	agg, err := NewAggregateTiler([]Tiler{til, &AggregateTiler{}})
+	require.NoError(t, err)
+
+	data := []float64{1, 2.5, 3, 4}
+	dst := make([]uint64, 0, 100)
+	dst = agg.TileInto(dst, data)
+	assert.Equal(t, agg.Tile(data), dst)
+	assert.Equal(t, 100, cap(dst), "dst should have been reused")
+}
+
+func TestAggregateTilerTileIntoDoesNotAllocate(t *testing.T) {
+	til1, _ := NewHashTiler(4)
+	til2, _ := NewHashTiler(2)
+	til, err := NewAggregateTiler([]Tiler{til1, til2})
+	require.NoError(t, err)
+	data := []float64{2.7, 4.3}
+	dst := make([]uint64, 6)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		dst = til.TileInto(dst, data)
+	})
+	assert.Zero(t, allocs)
+}
+
+// plainTiler is a Tiler which implements none of the optional interfaces.
+type plainTiler struct {
+	til Tiler
+}
+
+func (til plainTiler) Tile(data []float64) []uint64 {
+	return til.til.Tile(data)
+}
+
+func TestAggregateTilerTileWithInts(t *testing.T) {
+	til1, _ := NewHashTiler(4)
+	til2, _ := NewHashTiler(2)
+	singles, _ := NewSinglesTiler(2, 2)
+	til, err := NewAggregateTiler([]Tiler{til1, plainTiler{til2}, singles})
+	require.NoError(t, err)
+	data := []float64{2.7, 4.3}
+
+	assert.Equal(t, til.Tile(data), til.TileWithInts(data, nil), "no ints should be the same as Tile")
+	assert.Equal(t, til.TileWithInts(data, []int{1}), til.TileWithInts([]float64{2.71, 4.31}, []int{1}))
+	assert.Zero(t, numShared(til.TileWithInts(data, []int{1}), til.TileWithInts(data, []int{2})), "different ints should never share tiles")
+}
+
+func TestAggregateTilerCoordinates(t *testing.T) {
+	full, _ := NewHashTiler(1, WithCoordinateRecording())
+	inner, _ := NewHashTiler(1, WithCoordinateRecording())
+	pair, _ := NewSubsetTiler([]int{0, 2}, inner)
+	til, err := NewAggregateTiler([]Tiler{full, plainTiler{full}, pair})
+	require.NoError(t, err)
+
+	hashes := til.Tile([]float64{1.5, 2.5, 3.5})
+	require.Len(t, hashes, 3)
+
+	tc, ok := til.Coordinates(hashes[0])
+	require.True(t, ok)
+	assert.Equal(t, TileCoordinates{Coords: []int{1, 2, 3}}, tc)
+	tc, ok = til.Coordinates(hashes[2])
+	require.True(t, ok)
+	assert.Equal(t, TileCoordinates{Coords: []int{1, 3}, Dims: []int{0, 2}}, tc, "the pair should report its input dimensions")
+
+	singles, _ := NewSinglesTiler(2, 2)
+	_, ok = singles.Coordinates(singles.Tile([]float64{1, 2})[0])
+	assert.False(t, ok, "coordinates are not recorded by default")
+}
+
+func TestAggregateTilerRestores(t *testing.T) {
+	singles, err := NewSinglesTiler(3, 4)
+	require.NoError(t, err)
+	pairs, err := NewPairsTiler(3, 2)
+	require.NoError(t, err)
+	ht, err := NewHashTiler(8, WithTileWidths([]float64{0.5, 0.5, 2}))
+	require.NoError(t, err)
+	nested, err := NewAggregateTiler([]Tiler{singles, pairs, ht})
+	require.NoError(t, err)
+	subsets, err := NewSubsetsTiler([]Subset{{[]int{2, 0, 1}, 2, []float64{0.5, 1, 3}}, {[]int{1}, 1, nil}})
+	require.NoError(t, err)
+	tests := map[string]*AggregateTiler{
+		"Singles": singles,
+		"Pairs":   pairs,
+		"Nested":  nested,
+		"Subsets": subsets,
+	}
+
+	for name, til := range tests {
+		t.Run(name, func(t *testing.T) {
+			binary, err := til.MarshalBinary()
+			require.NoError(t, err)
+			fromBinary := &AggregateTiler{}
+			require.NoError(t, fromBinary.UnmarshalBinary(binary))
+
+			js, err := til.MarshalJSON()
+			require.NoError(t, err)
+			fromJSON := &AggregateTiler{}
+			require.NoError(t, fromJSON.UnmarshalJSON(js))
+
+			for i := 0; i < 10; i++ {
+				data := makeValues(3)
+				assert.Equal(t, til.Tile(data), fromBinary.Tile(data))
+				assert.Equal(t, til.Tile(data), fromJSON.Tile(data))
+			}
+		})
+	}
+}
+
+func TestAggregateTilerMarshalUnsupportedTiler(t *testing.T) {
+	ht, _ := NewHashTiler(2)
+	til, err := NewAggregateTiler([]Tiler{ht, plainTiler{ht}})
+	require.NoError(t, err)
+
+	_, err = til.MarshalBinary()
+	assert.Error(t, err)
+	_, err = til.MarshalJSON()
+	assert.Error(t, err)
+}
+
+func TestAggregateTilerUnmarshalInvalid(t *testing.T) {
+	tests := map[string]string{
+		"Not aggregate":  `{"type":"hash","hash":{"numTilings":2,"seed":"1"}}`,
+		"Unknown type":   `{"type":"aggregate","tilers":[{"type":"magic"}]}`,
+		"Missing hash":   `{"type":"aggregate","tilers":[{"type":"hash"}]}`,
+		"Invalid hash":   `{"type":"aggregate","tilers":[{"type":"hash","hash":{"numTilings":0,"seed":"1"}}]}`,
+		"Missing subset": `{"type":"aggregate","tilers":[{"type":"subset","dims":[0]}]}`,
+		"Negative dim":   `{"type":"aggregate","tilers":[{"type":"subset","dims":[-1],"tiler":{"type":"hash","hash":{"numTilings":2,"seed":"1"}}}]}`,
+	}
+
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			til := &AggregateTiler{}
+			assert.Error(t, til.UnmarshalJSON([]byte(data)))
+		})
+	}
+}
+
+func TestKSubsets(t *testing.T) {
+	tests := map[string]struct {
+		numDims, k int
+		expected   [][]int
+	}{
+		"Singles":  {3, 1, [][]int{{0}, {1}, {2}}},
+		"Pairs":    {4, 2, [][]int{{0, 1}, {0, 2}, {0, 3}, {1, 2}, {1, 3}, {2, 3}}},
+		"Triples":  {4, 3, [][]int{{0, 1, 2}, {0, 1, 3}, {0, 2, 3}, {1, 2, 3}}},
+		"Joint":    {3, 3, [][]int{{0, 1, 2}}},
+		"Zero":     {3, 0, [][]int{}},
+		"Too many": {2, 3, [][]int{}},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			subsets := KSubsets(test.numDims, test.k, 7)
+			dims := [][]int{}
+			for _, subset := range subsets {
+				assert.Equal(t, 7, subset.NumTilings)
+				dims = append(dims, subset.Dims)
+			}
+			assert.Equal(t, test.expected, dims)
+		})
+	}
+}
+
+func TestSubsetsTilerGeneralization(t *testing.T) {
+	til, err := NewSubsetsTiler([]Subset{{[]int{0}, 2, nil}, {[]int{1, 2}, 4, nil}, {[]int{0, 1, 3}, 8, nil}})
+	require.NoError(t, err)
+
+	data := []float64{1.5, 2.5, 3.5, 4.5}
+	hashes := til.Tile(data)
+	require.Len(t, hashes, 14)
+
+	// Changing a dimension only changes the hashes of the subsets which contain it.
+	other := til.Tile([]float64{1.5, 2.5, 3.5, 9.5})
+	assert.Equal(t, hashes[:6], other[:6])
+	assert.Zero(t, numShared(hashes[6:], other[6:]))
+
+	other = til.Tile([]float64{1.5, 7.5, 3.5, 4.5})
+	assert.Equal(t, hashes[:2], other[:2])
+	assert.Zero(t, numShared(hashes[2:], other[2:]))
+}
+
+func TestSinglesPairsJointTiler(t *testing.T) {
+	tests := map[int]int{
+		1: 1,
+		2: 3,
+		3: 7,
+		5: 16,
+	}
+
+	for numDims, numSubsets := range tests {
+		t.Run(fmt.Sprint(numDims), func(t *testing.T) {
+			til, err := NewSinglesPairsJointTiler(numDims, 4)
+			require.NoError(t, err)
+			assert.Len(t, til.Tile(makeValues(numDims)), numSubsets*4)
+		})
+	}
+}
+
+func TestSubsetsTilerInvalid(t *testing.T) {
+	tests := map[string]struct {
+		subsets []Subset
+		errType error
+	}{
+		"Empty":      {[]Subset{{[]int{0}, 1, nil}, {[]int{}, 1, nil}}, InvalidSubsetError{}},
+		"Negative":   {[]Subset{{[]int{0, -1}, 1, nil}}, InvalidSubsetError{}},
+		"Repeated":   {[]Subset{{[]int{1, 2, 1}, 1, nil}}, InvalidSubsetError{}},
+		"Tilings":    {[]Subset{{[]int{1, 2}, 0, nil}}, InvalidNumTilingsError{}},
+		"Widths":     {[]Subset{{[]int{1, 2}, 2, []float64{1}}}, InvalidSubsetError{}},
+		"Zero width": {[]Subset{{[]int{1, 2}, 2, []float64{1, 0}}}, InvalidOptionError{}},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			til, err := NewSubsetsTiler(test.subsets)
+			assert.IsType(t, test.errType, err)
+			assert.Nil(t, til)
+		})
+	}
+}
+
+func TestSubsetOptions(t *testing.T) {
+	// Coarse pairs next to fine singles, with the second dimension twice as wide as the first.
+	singles, err := NewSinglesTiler(2, 4, WithSubsetTilings([]int{8, 2}), WithDimWidths([]float64{0.5, 1}))
+	require.NoError(t, err)
+	pairs, err := NewPairsTiler(3, 4, WithSubsetWidths([][]float64{{2, 2}, {2, 4}, {4, 4}}))
+	require.NoError(t, err)
+
+	assert.Len(t, singles.Tile([]float64{1, 2}), 10)
+	assert.Len(t, pairs.Tile([]float64{1, 2, 3}), 12)
+
+	// Each subset should have the same hashes as a HashTiler with the same configuration.
+	tests := []struct {
+		til      *AggregateTiler
+		idx      int
+		widths   []float64
+		dims     []int
+		start    int
+		numTiles int
+	}{
+		{singles, 0, []float64{0.5}, []int{0}, 0, 8},
+		{singles, 1, []float64{1}, []int{1}, 8, 2},
+		{pairs, 1, []float64{2, 4}, []int{0, 2}, 4, 4},
+	}
+	for _, test := range tests {
+		st := test.til.tils[test.idx].(*SubsetTiler)
+		assert.Equal(t, test.dims, st.dims)
+		ht, err := NewHashTiler(test.numTiles, WithSeed(st.til.(*HashTiler).Seed()), WithTileWidths(test.widths))
+		require.NoError(t, err)
+		for i := 0; i < 5; i++ {
+			data := makeValues(3)
+			subset := make([]float64, len(test.dims))
+			for j, dim := range test.dims {
+				subset[j] = data[dim]
+			}
+			assert.Equal(t, ht.Tile(subset), test.til.Tile(data)[test.start:test.start+test.numTiles])
+		}
+	}
+}
+
+func TestSubsetOptionsInvalid(t *testing.T) {
+	tests := map[string][]SubsetOption{
+		"Tilings count":    {WithSubsetTilings([]int{1, 2})},
+		"Invalid tilings":  {WithSubsetTilings([]int{1, 2, 0})},
+		"Missing width":    {WithDimWidths([]float64{1, 1})},
+		"Subset count":     {WithSubsetWidths([][]float64{{1, 1}})},
+		"Subset dimension": {WithSubsetWidths([][]float64{{1, 1}, {1}, {1, 1}})},
+	}
+
+	for name, opts := range tests {
+		t.Run(name, func(t *testing.T) {
+			til, err := NewPairsTiler(3, 4, opts...)
+			assert.Error(t, err)
+			assert.Nil(t, til)
+		})
+	}
+}
+
+func TestAggregateTilerWorkersMatchSerial(t *testing.T) {
+	pairs, err := NewPairsTiler(10, 4)
+	require.NoError(t, err)
+	parallel, err := NewAggregateTiler(pairs.Tilers(), WithWorkers(4))
+	require.NoError(t, err)
+	singles, err := NewSinglesTiler(10, 2)
+	require.NoError(t, err)
+	nested, err := NewAggregateTiler([]Tiler{singles, parallel}, WithWorkers(2))
+	require.NoError(t, err)
+	serialNested, err := NewAggregateTiler([]Tiler{singles, pairs})
+	require.NoError(t, err)
+
+	dst := make([]uint64, 180)
+	for i := 0; i < 10; i++ {
+		data := makeValues(10)
+		expected := pairs.Tile(data)
+		assert.Equal(t, expected, parallel.Tile(data))
+		assert.Equal(t, expected, parallel.TileInto(dst, data))
+		assert.Equal(t, expected, dst, "TileInto should reuse dst")
+		assert.Equal(t, pairs.TileWithInts(data, []int{i}), parallel.TileWithInts(data, []int{i}))
+		assert.Equal(t, serialNested.Tile(data), nested.Tile(data))
+	}
+}
+
+func TestSubsetsTilerWorkers(t *testing.T) {
+	subsets := KSubsets(6, 2, 4)
+	serial, err := NewSubsetsTiler(subsets)
+	require.NoError(t, err)
+	parallel, err := NewSubsetsTiler(subsets, WithWorkers(3))
+	require.NoError(t, err)
+	assert.Equal(t, 3, parallel.workers)
+	pairs, err := NewPairsTiler(6, 4, WithAggregateOptions(WithWorkers(4)), WithSubsetTilings([]int{1, 2, 3, 1, 2, 3, 1, 2, 3, 1, 2, 3, 1, 2, 3}))
+	require.NoError(t, err)
+	assert.Equal(t, 4, pairs.workers)
+
+	// Only the seeds differ, so the parallel AggregateTiler can be given the serial AggregateTiler's seeds.
+	saved, err := serial.MarshalBinary()
+	require.NoError(t, err)
+	require.NoError(t, parallel.UnmarshalBinary(saved))
+	assert.Equal(t, 3, parallel.workers, "restoring the Tilers should keep the workers")
+	for i := 0; i < 5; i++ {
+		data := makeValues(6)
+		assert.Equal(t, serial.Tile(data), parallel.Tile(data))
+		assert.Len(t, pairs.Tile(data), 30)
+	}
+
+	_, err = NewPairsTiler(6, 4, WithAggregateOptions(WithWorkers(0)))
+	assert.IsType(t, InvalidOptionError{}, err)
+}
+
+func TestAggregateTilerWorkersAfterUnmarshal(t *testing.T) {
+	small, err := NewPairsTiler(3, 4, WithAggregateOptions(WithWorkers(4)))
+	require.NoError(t, err)
+	small.Tile(makeValues(3))
+
+	large, err := NewPairsTiler(6, 4)
+	require.NoError(t, err)
+	saved, err := large.MarshalJSON()
+	require.NoError(t, err)
+
+	// The layout found for the smaller tree must not be used for the new Tilers.
+	require.NoError(t, small.UnmarshalJSON(saved))
+	for i := 0; i < 3; i++ {
+		data := makeValues(6)
+		assert.Equal(t, large.Tile(data), small.Tile(data))
+	}
+
+	var restored AggregateTiler
+	require.NoError(t, restored.UnmarshalJSON(saved))
+	assert.Equal(t, 1, restored.workers)
+}
+
+func TestAggregateTilerWorkersAreSafeForConcurrentUse(t *testing.T) {
+	// Run with -race to confirm there are no data races.
+	pairs, err := NewPairsTiler(6, 4)
+	require.NoError(t, err)
+	parallel, err := NewAggregateTiler(pairs.Tilers(), WithWorkers(3))
+	require.NoError(t, err)
+
+	data := make([][]float64, 50)
+	for i := range data {
+		data[i] = makeValues(6)
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, d := range data {
+				assert.Equal(t, pairs.Tile(d), parallel.Tile(d))
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestAggregateTilerWorkersHandleChangedLength(t *testing.T) {
+	ht, _ := NewHashTiler(4)
+	serial, err := NewAggregateTiler([]Tiler{identityTiler{}, ht, identityTiler{}})
+	require.NoError(t, err)
+	parallel, err := NewAggregateTiler(serial.Tilers(), WithWorkers(3))
+	require.NoError(t, err)
+
+	// The number of hashes from identityTiler depends on the length of the data.
+	for _, data := range [][]float64{{1, 2}, {3, 4}, {5, 6, 7}, {8}, {9}} {
+		assert.Equal(t, serial.Tile(data), parallel.Tile(data))
+	}
+}
+
+func TestAggregateTilerInvalidWorkers(t *testing.T) {
+	til, err := NewAggregateTiler(nil, WithWorkers(0))
+	assert.IsType(t, InvalidOptionError{}, err)
+	assert.Nil(t, til)
+}
+
+func BenchmarkAggregateTilerPairs(b *testing.B) {
+	const numDims = 30
+	pairs, err := NewPairsTiler(numDims, 8)
+	require.NoError(b, err)
+	data := makeValues(numDims)
+
+	// The speedup depends on GOMAXPROCS, since there's no benefit from more workers than processors.
+	for _, num := range []int{1, 2, 4, 8} {
+		til, err := NewAggregateTiler(pairs.Tilers(), WithWorkers(num))
+		require.NoError(b, err)
+		b.Run(fmt.Sprintf("%d workers", num), func(b *testing.B) {
+			dst := til.Tile(data)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				dst = til.TileInto(dst, data)
+			}
+		})
+	}
+}
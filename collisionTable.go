@@ -0,0 +1,213 @@
+package tile
+
+import "fmt"
+
+// CollisionSafety determines how a CollisionTable handles different hashes which map to the same slot.
+type CollisionSafety int
+
+const (
+	// UnsafeCollisions lets hashes which map to the same slot share its index. Collisions are still counted, since
+	// each slot stores a check value for the hash which first used it.
+	UnsafeCollisions CollisionSafety = iota
+
+	// SafeCollisions stores a 32-bit check value for each slot. When a hash maps to a slot with a different check
+	// value, other slots are probed until a free or matching slot is found. Different hashes only share an index if
+	// their check values also match, which is very rare.
+	SafeCollisions
+
+	// SuperSafeCollisions is like SafeCollisions, but the full hash is compared, so different hashes never share an
+	// index unless the table is full.
+	SuperSafeCollisions
+)
+
+func (safety CollisionSafety) String() string {
+	switch safety {
+	case UnsafeCollisions:
+		return "UnsafeCollisions"
+	case SafeCollisions:
+		return "SafeCollisions"
+	case SuperSafeCollisions:
+		return "SuperSafeCollisions"
+	default:
+		return fmt.Sprintf("CollisionSafety(%d)", int(safety))
+	}
+}
+
+// CollisionTable is used for tile coding when a slice of indices is desired with a fixed amount of memory. It is
+// equivalent to the collision table of Sutton's tiles software: each hash is assigned a slot in a fixed-size table
+// using open addressing, and statistics about collisions are recorded so the memory size can be chosen from data.
+type CollisionTable struct {
+	// ht is the underlying Tiler that generates the hashes.
+	ht Tiler
+
+	// safety determines how collisions are handled.
+	safety CollisionSafety
+	// offset is the offset added to every index.
+	offset int
+
+	// used records which slots have been assigned to a hash.
+	used []bool
+	// checks stores the check value of the hash in each used slot.
+	checks []uint64
+
+	// stats records the statistics reported by Stats.
+	stats CollisionStats
+
+	// hashes is reused by TileInto to store the output of ht.
+	hashes []uint64
+}
+
+// CollisionStats describes how a CollisionTable has been used.
+type CollisionStats struct {
+	// MemorySize is the number of slots in the table.
+	MemorySize int
+	// Occupied is the number of slots which have been assigned to a hash.
+	Occupied int
+	// Calls is the number of hashes which have been looked up.
+	Calls int
+	// ClearHits is the number of lookups which found a matching or free slot without probing.
+	ClearHits int
+	// Collisions is the number of times a lookup found a slot used by a different hash. Each probe is counted.
+	Collisions int
+	// Overfull is the number of lookups which could not be assigned their own slot because the table was full.
+	Overfull int
+}
+
+// Occupancy returns the fraction of slots which are in use.
+func (stats CollisionStats) Occupancy() float64 {
+	return float64(stats.Occupied) / float64(stats.MemorySize)
+}
+
+// CollisionTableFullError is returned by CheckError when a CollisionTable was too full to give a hash its own slot.
+type CollisionTableFullError struct {
+	MemorySize int
+	Overfull   int
+}
+
+func (err CollisionTableFullError) Error() string {
+	return fmt.Sprintf("collision table of size %d was full for %d lookups", err.MemorySize, err.Overfull)
+}
+
+// NewCollisionTable creates a new CollisionTable, which returns a slice of indices in the range [0, memorySize) based
+// on the tiles' hashes. Hashes are calculated by the provided Tiler.
+func NewCollisionTable(til Tiler, memorySize int, safety CollisionSafety) (*CollisionTable, error) {
+	return NewCollisionTableWithOffset(til, 0, memorySize, safety)
+}
+
+// NewCollisionTableWithOffset creates a new CollisionTable, but with an offset added to each provided index.
+// Indices output by Tile will be in the range [offset, memorySize+offset).
+func NewCollisionTableWithOffset(til Tiler, offset, memorySize int, safety CollisionSafety) (*CollisionTable, error) {
+	switch safety {
+	case UnsafeCollisions, SafeCollisions, SuperSafeCollisions:
+	default:
+		return nil, InvalidOptionError{"safety", fmt.Sprintf("unknown collision safety %v", safety)}
+	}
+	if memorySize < 1 {
+		return nil, InvalidMemorySizeError{memorySize, "must be at least 1"}
+	}
+	return &CollisionTable{
+		ht:     til,
+		safety: safety,
+		offset: offset,
+		used:   make([]bool, memorySize),
+		checks: make([]uint64, memorySize),
+		stats:  CollisionStats{MemorySize: memorySize},
+	}, nil
+}
+
+// Tile returns a vector of indices describing the input data.
+// The length of the input data is not checked, but it is generally expected that the input
+// length should always be the same for calls to the same CollisionTable.
+func (ct *CollisionTable) Tile(data []float64) []int {
+	return ct.TileInto(nil, data)
+}
+
+// TileInto is like Tile, but the indices are written into dst if its capacity is large enough. If the underlying
+// Tiler is an IntoTiler, TileInto does not allocate when dst is large enough.
+func (ct *CollisionTable) TileInto(dst []int, data []float64) []int {
+	ct.hashes = tileInto(ct.ht, ct.hashes, data)
+	return ct.indices(dst, ct.hashes)
+}
+
+// TileWithInts is like Tile, but the ints are also hashed without being tiled. See IntTiler for details.
+func (ct *CollisionTable) TileWithInts(data []float64, ints []int) []int {
+	return ct.indices(nil, tileWithInts(ct.ht, data, ints))
+}
+
+// indices writes the index of each hash into dst, reusing it if its capacity is large enough.
+func (ct *CollisionTable) indices(dst []int, hashes []uint64) []int {
+	if cap(dst) < len(hashes) {
+		dst = make([]int, len(hashes))
+	}
+	indices := dst[:len(hashes)]
+	for i, hash := range hashes {
+		indices[i] = ct.Index(hash)
+	}
+	return indices
+}
+
+// Index returns the index assigned to a hash, assigning a slot to the hash if it hasn't been seen before.
+func (ct *CollisionTable) Index(hash uint64) int {
+	ct.stats.Calls++
+
+	size := len(ct.used)
+	home := int(hash % uint64(size))
+	check := ct.check(hash)
+
+	slot := home
+	for probes := 0; probes < size; probes++ {
+		switch {
+		case !ct.used[slot]:
+			ct.used[slot] = true
+			ct.checks[slot] = check
+			ct.stats.Occupied++
+			if probes == 0 {
+				ct.stats.ClearHits++
+			}
+			return slot + ct.offset
+		case ct.checks[slot] == check:
+			if probes == 0 {
+				ct.stats.ClearHits++
+			}
+			return slot + ct.offset
+		}
+
+		ct.stats.Collisions++
+		if ct.safety == UnsafeCollisions {
+			return slot + ct.offset
+		}
+		slot = (slot + 1) % size
+	}
+
+	// Every slot was probed without finding a match, so the hash has to share its home slot.
+	ct.stats.Overfull++
+	return home + ct.offset
+}
+
+// check returns the value stored to identify the hash in its slot.
+func (ct CollisionTable) check(hash uint64) uint64 {
+	if ct.safety == SuperSafeCollisions {
+		return hash
+	}
+	// Re-hash so the check value is independent of the slot, which is chosen by the low bits of the hash.
+	return hashFinish(hash) >> 32
+}
+
+// Stats returns statistics describing how the table has been used.
+func (ct CollisionTable) Stats() CollisionStats {
+	return ct.stats
+}
+
+// NumIndices returns the number of slots in the table (i.e. memorySize).
+func (ct CollisionTable) NumIndices() int {
+	return len(ct.used)
+}
+
+// CheckError returns a CollisionTableFullError if the table was ever too full to give a hash its own slot.
+// Collisions allowed by UnsafeCollisions are not considered to be errors.
+func (ct CollisionTable) CheckError() error {
+	if ct.stats.Overfull == 0 {
+		return nil
+	}
+	return CollisionTableFullError{ct.stats.MemorySize, ct.stats.Overfull}
+}
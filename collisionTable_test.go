@@ -0,0 +1,120 @@
+package tile
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var _ = IndexTiler(&CollisionTable{})      // Conform to interface
+var _ = SizedIndexTiler(&CollisionTable{}) // Conform to interface
+
+func TestCollisionTableSafety(t *testing.T) {
+	// Hashes 1 and 5 both map to slot 1 of a table with 4 slots.
+	tests := map[CollisionSafety]struct {
+		expected   []int
+		collisions int
+	}{
+		UnsafeCollisions:    {[]int{1, 1, 1, 1}, 2},
+		SafeCollisions:      {[]int{1, 2, 1, 2}, 2},
+		SuperSafeCollisions: {[]int{1, 2, 1, 2}, 2},
+	}
+
+	for safety, test := range tests {
+		t.Run(safety.String(), func(t *testing.T) {
+			ct, err := NewCollisionTable(nil, 4, safety)
+			require.NoError(t, err)
+
+			actual := []int{ct.Index(1), ct.Index(5), ct.Index(1), ct.Index(5)}
+			assert.Equal(t, test.expected, actual)
+
+			stats := ct.Stats()
+			assert.Equal(t, 4, stats.Calls)
+			assert.Equal(t, test.collisions, stats.Collisions)
+			assert.Equal(t, 4-test.collisions, stats.ClearHits)
+			assert.Zero(t, stats.Overfull)
+			assert.NoError(t, ct.CheckError())
+		})
+	}
+}
+
+func TestCollisionTableOverfull(t *testing.T) {
+	ct, err := NewCollisionTableWithOffset(nil, 10, 3, SuperSafeCollisions)
+	require.NoError(t, err)
+
+	for hash := uint64(0); hash < 3; hash++ {
+		assert.Equal(t, int(hash)+10, ct.Index(hash))
+	}
+	require.NoError(t, ct.CheckError())
+
+	assert.Equal(t, 11, ct.Index(4), "a full table should return the home slot")
+	stats := ct.Stats()
+	assert.Equal(t, 1, stats.Overfull)
+	assert.Equal(t, 3, stats.Occupied)
+	assert.Equal(t, 1.0, stats.Occupancy())
+
+	err = ct.CheckError()
+	require.Error(t, err)
+	assert.Equal(t, CollisionTableFullError{3, 1}, err)
+}
+
+func TestCollisionTableTile(t *testing.T) {
+	til, err := NewHashTiler(8)
+	require.NoError(t, err)
+	ct, err := NewCollisionTable(til, 1024, SafeCollisions)
+	require.NoError(t, err)
+
+	first := ct.Tile([]float64{3.14, 2.718})
+	assert.Len(t, first, 8)
+	assert.Equal(t, first, ct.Tile([]float64{3.141, 2.7181}))
+	assert.Equal(t, first, ct.TileInto(nil, []float64{3.14, 2.718}))
+	assert.Equal(t, first, ct.TileWithInts([]float64{3.14, 2.718}, nil))
+
+	// Every tile in a tiling is distinct, so every index should be different.
+	seen := map[int]bool{}
+	for _, idx := range append(first, ct.TileWithInts([]float64{3.14, 2.718}, []int{2})...) {
+		assert.False(t, seen[idx], "index %d was used twice", idx)
+		seen[idx] = true
+	}
+
+	stats := ct.Stats()
+	assert.Equal(t, 16, stats.Occupied)
+	assert.Equal(t, 40, stats.Calls)
+	assert.InDelta(t, 16.0/1024, stats.Occupancy(), 1e-12)
+}
+
+func TestCollisionTableInvalid(t *testing.T) {
+	ct, err := NewCollisionTable(nil, 0, SafeCollisions)
+	assert.IsType(t, InvalidMemorySizeError{}, err)
+	assert.Nil(t, ct)
+
+	ct, err = NewCollisionTable(nil, 16, CollisionSafety(-1))
+	assert.IsType(t, InvalidOptionError{}, err)
+	assert.Nil(t, ct)
+}
+
+func BenchmarkCollisionTable(b *testing.B) {
+	benchmarks := []struct {
+		name          string
+		values, tiles int
+	}{
+		{"1x1", 1, 1},
+		{"4x16", 4, 16},
+		{"100x128", 100, 128},
+	}
+
+	for _, bench := range benchmarks {
+		b.Run(bench.name, func(b *testing.B) {
+			v := makeValues(bench.values)
+			til, _ := NewHashTiler(bench.tiles)
+			ct, _ := NewCollisionTable(til, 16384, SafeCollisions)
+			indices := []int{}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				indices = ct.TileInto(indices, v)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package tile
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// numShards is the number of independently locked maps used by a ConcurrentIndexingTiler. It must be a power of 2.
+const numShards = 64
+
+// ConcurrentIndexingTiler is like IndexingTiler, but it is safe to use from multiple goroutines at once, e.g. when
+// parallel actors share one tiler. Indices are consistent across goroutines: a tile always has the same index no
+// matter which goroutine sees it first. The underlying Tiler must also be safe for concurrent use, which is true of
+// HashTiler, AggregateTiler, and SubsetTiler.
+//
+// Hashes are stored in maps which are locked separately, so goroutines rarely wait for each other. Unlike
+// IndexingTiler, indices are never evicted: if all indices are in use, each new tile shares an index with an existing
+// tile (reused in round-robin order) and the overflow is reported by CheckError.
+type ConcurrentIndexingTiler struct {
+	// The following are accessed atomically, so they are first to ensure 64-bit alignment. assigned is the number of
+	// hashes which have been assigned an index, calls is the number of calls to Tile, overflows is the number of
+	// hashes which had to share an index, and firstOverflowCall is the call during which the first overflow occurred.
+	assigned, calls, overflows, firstOverflowCall int64
+
+	// ht is the underlying Tiler that generates the hashes.
+	ht Tiler
+
+	// indexSize is the maximum number of indices to be assigned.
+	indexSize int
+	// offset is the offset added to every index.
+	offset int
+
+	// shards store an index for each hash that has been seen so far. The shard is chosen by the hash.
+	shards [numShards]indexShard
+}
+
+// indexShard is one of the maps of a ConcurrentIndexingTiler.
+type indexShard struct {
+	sync.RWMutex
+	mp map[uint64]int
+}
+
+// NewConcurrentIndexingTiler creates a new ConcurrentIndexingTiler, which returns a slice of indices based on the
+// tiles' hashes. If indexSize is UnlimitedIndices, then the number of indices is unlimited. Otherwise, it must be at
+// least 1, and overflow is reported through CheckError().
+func NewConcurrentIndexingTiler(til Tiler, indexSize int) (*ConcurrentIndexingTiler, error) {
+	return NewConcurrentIndexingTilerWithOffset(til, 0, indexSize)
+}
+
+// NewConcurrentIndexingTilerWithOffset creates a new ConcurrentIndexingTiler, but with an offset added to each
+// provided index. Indices output by Tile will be in the range [offset, indexSize+offset).
+func NewConcurrentIndexingTilerWithOffset(til Tiler, offset, indexSize int) (*ConcurrentIndexingTiler, error) {
+	if indexSize < 1 {
+		return nil, InvalidMemorySizeError{indexSize, "must be at least 1"}
+	}
+	it := &ConcurrentIndexingTiler{
+		ht:        til,
+		indexSize: indexSize,
+		offset:    offset,
+	}
+	for i := range it.shards {
+		it.shards[i].mp = make(map[uint64]int)
+	}
+	return it, nil
+}
+
+// Tile returns a vector of indices describing the input data. It may be called from multiple goroutines at once.
+// The length of the input data is not checked, but it is generally expected that the input
+// length should always be the same for calls to the same ConcurrentIndexingTiler.
+func (it *ConcurrentIndexingTiler) Tile(data []float64) []int {
+	return it.TileInto(nil, data)
+}
+
+// TileInto is like Tile, but the indices are written into dst if its capacity is large enough.
+func (it *ConcurrentIndexingTiler) TileInto(dst []int, data []float64) []int {
+	return it.indices(dst, it.ht.Tile(data))
+}
+
+// TileWithInts is like Tile, but the ints are also hashed without being tiled. See IntTiler for details.
+func (it *ConcurrentIndexingTiler) TileWithInts(data []float64, ints []int) []int {
+	return it.indices(nil, tileWithInts(it.ht, data, ints))
+}
+
+// indices writes the index of each hash into dst, reusing it if its capacity is large enough.
+func (it *ConcurrentIndexingTiler) indices(dst []int, hashes []uint64) []int {
+	if cap(dst) < len(hashes) {
+		dst = make([]int, len(hashes))
+	}
+	indices := dst[:len(hashes)]
+	call := atomic.AddInt64(&it.calls, 1)
+	for i, hash := range hashes {
+		indices[i] = it.index(hash, call)
+	}
+	return indices
+}
+
+// index returns the index of the hash, assigning one if necessary.
+func (it *ConcurrentIndexingTiler) index(hash uint64, call int64) int {
+	shard := &it.shards[hash&(numShards-1)]
+
+	shard.RLock()
+	idx, ok := shard.mp[hash]
+	shard.RUnlock()
+	if ok {
+		return idx
+	}
+
+	shard.Lock()
+	defer shard.Unlock()
+	if idx, ok := shard.mp[hash]; ok {
+		// Another goroutine assigned an index after the read lock was released.
+		return idx
+	}
+
+	next := int(atomic.AddInt64(&it.assigned, 1) - 1)
+	if it.indexSize != UnlimitedIndices && next >= it.indexSize {
+		if atomic.AddInt64(&it.overflows, 1) == 1 {
+			atomic.StoreInt64(&it.firstOverflowCall, call)
+		}
+		next %= it.indexSize
+	}
+	idx = next + it.offset
+	shard.mp[hash] = idx
+	return idx
+}
+
+// NumIndices returns the maximum number of indices (i.e. indexSize), which may be UnlimitedIndices.
+func (it *ConcurrentIndexingTiler) NumIndices() int {
+	return it.indexSize
+}
+
+// CheckError returns an IndexOverflowError if more indices were used than expected.
+// There is no reason to check it if indexSize is UnlimitedIndices.
+func (it *ConcurrentIndexingTiler) CheckError() error {
+	overflows := atomic.LoadInt64(&it.overflows)
+	if overflows == 0 {
+		return nil
+	}
+	return IndexOverflowError{
+		IndexSize:         it.indexSize,
+		Overflows:         int(overflows),
+		DistinctHashes:    int(atomic.LoadInt64(&it.assigned)),
+		FirstOverflowCall: int(atomic.LoadInt64(&it.firstOverflowCall)),
+	}
+}
+
+// ClearError clears the error returned by CheckError, so it only reports overflows that occur after this call.
+func (it *ConcurrentIndexingTiler) ClearError() {
+	atomic.StoreInt64(&it.overflows, 0)
+	atomic.StoreInt64(&it.firstOverflowCall, 0)
+}
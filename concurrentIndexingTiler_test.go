@@ -0,0 +1,108 @@
+package tile
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var _ = IndexTiler(&ConcurrentIndexingTiler{})      // Conform to interface
+var _ = SizedIndexTiler(&ConcurrentIndexingTiler{}) // Conform to interface
+
+func TestConcurrentIndexingTilerMatchesIndexingTiler(t *testing.T) {
+	til, err := NewHashTiler(4)
+	require.NoError(t, err)
+	it, err := NewIndexingTilerWithOffset(til, 15, UnlimitedIndices)
+	require.NoError(t, err)
+	cit, err := NewConcurrentIndexingTilerWithOffset(til, 15, UnlimitedIndices)
+	require.NoError(t, err)
+
+	// When used from one goroutine, indices are assigned in the same order as IndexingTiler.
+	for _, data := range [][]float64{{4.99}, {5.24}, {5.25}, {5.49}, {-3}} {
+		assert.Equal(t, it.Tile(data), cit.Tile(data))
+	}
+	assert.Equal(t, it.TileWithInts([]float64{1}, []int{2}), cit.TileWithInts([]float64{1}, []int{2}))
+	assert.NoError(t, cit.CheckError())
+}
+
+func TestConcurrentIndexingTilerIsConsistentAcrossGoroutines(t *testing.T) {
+	// Run with -race to confirm there are no data races.
+	const numGoroutines = 16
+	const numTilings = 8
+	til, err := NewHashTiler(numTilings)
+	require.NoError(t, err)
+	cit, err := NewConcurrentIndexingTiler(til, UnlimitedIndices)
+	require.NoError(t, err)
+
+	data := make([][]float64, 200)
+	for i := range data {
+		data[i] = makeValues(2)
+	}
+
+	results := make([][][]int, numGoroutines)
+	var wg sync.WaitGroup
+	for g := 0; g < numGoroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			results[g] = make([][]int, len(data))
+			for i := range data {
+				// Each goroutine visits the data in a different order.
+				j := (i + g*13) % len(data)
+				if g%2 == 1 {
+					j = len(data) - 1 - j
+				}
+				results[g][j] = cit.Tile(data[j])
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	// Every goroutine must see the same indices.
+	for g := 1; g < numGoroutines; g++ {
+		assert.Equal(t, results[0], results[g], "goroutine %d", g)
+	}
+
+	// Compare to the hashes to confirm that indices are dense and each hash has exactly one index.
+	hashToIndex := map[uint64]int{}
+	indexToHash := map[int]uint64{}
+	for i := range data {
+		for j, hash := range til.Tile(data[i]) {
+			idx := results[0][i][j]
+			hashToIndex[hash] = idx
+			indexToHash[idx] = hash
+		}
+	}
+	assert.Equal(t, len(hashToIndex), len(indexToHash))
+	for idx := range indexToHash {
+		assert.Less(t, idx, len(indexToHash))
+	}
+	assert.NoError(t, cit.CheckError())
+}
+
+func TestConcurrentIndexingTilerInvalidSize(t *testing.T) {
+	for _, size := range []int{0, -1} {
+		cit, err := NewConcurrentIndexingTilerWithOffset(identityTiler{}, 5, size)
+		assert.IsType(t, InvalidMemorySizeError{}, err)
+		assert.Nil(t, cit)
+	}
+}
+
+func TestConcurrentIndexingTilerOverflow(t *testing.T) {
+	cit, err := NewConcurrentIndexingTilerWithOffset(identityTiler{}, 10, 2)
+	require.NoError(t, err)
+
+	assert.Equal(t, []int{10, 11}, cit.Tile([]float64{1, 2}))
+	require.NoError(t, cit.CheckError())
+	assert.Equal(t, []int{10, 11, 10}, cit.Tile([]float64{3, 4, 1}))
+
+	var overflow IndexOverflowError
+	require.True(t, errors.As(cit.CheckError(), &overflow))
+	assert.Equal(t, IndexOverflowError{IndexSize: 2, Overflows: 2, DistinctHashes: 4, FirstOverflowCall: 2}, overflow)
+
+	cit.ClearError()
+	assert.NoError(t, cit.CheckError())
+}
@@ -0,0 +1,360 @@
+package tile
+
+import (
+	"container/heap"
+	"fmt"
+	"math/bits"
+)
+
+// EvictionPolicy determines which index an IndexingTiler reuses for a new tile once all of its indices are in use.
+type EvictionPolicy int
+
+const (
+	// RoundRobinEviction reuses indices in order, starting again from the first index. This is the default.
+	RoundRobinEviction EvictionPolicy = iota
+
+	// LeastRecentlyUsedEviction reuses the index which was least recently returned by Tile.
+	LeastRecentlyUsedEviction
+
+	// LeastFrequentlyUsedEviction reuses the index which has been returned by Tile the fewest times since it was
+	// assigned to its current tile. Ties are broken by reusing the lowest index.
+	LeastFrequentlyUsedEviction
+
+	// RandomEviction reuses a random index. The sequence of random choices is the same every time a program runs, and
+	// it continues where it left off when a serialized IndexingTiler is restored.
+	RandomEviction
+)
+
+func (policy EvictionPolicy) String() string {
+	switch policy {
+	case RoundRobinEviction:
+		return "RoundRobinEviction"
+	case LeastRecentlyUsedEviction:
+		return "LeastRecentlyUsedEviction"
+	case LeastFrequentlyUsedEviction:
+		return "LeastFrequentlyUsedEviction"
+	case RandomEviction:
+		return "RandomEviction"
+	default:
+		return fmt.Sprintf("EvictionPolicy(%d)", int(policy))
+	}
+}
+
+// Eviction describes a hash which lost its index so the index could be reused for a different hash.
+type Eviction struct {
+	Hash  uint64
+	Index int
+}
+
+// evictor implements an EvictionPolicy. Slots are numbered from 0, and they are first used in order.
+type evictor interface {
+	// use records that the slot was returned by Tile. If fresh, the slot was just assigned to a new hash.
+	use(slot int, fresh bool)
+	// victim returns the slot that should be reused, given the total number of slots.
+	victim(numSlots int) int
+
+	// state returns the evictor's state so it can be serialized.
+	state() []int
+	// checkState returns an error if st could not have been returned by state when there were numSlots slots.
+	checkState(st []int, numSlots int) error
+	// setState restores the result of state.
+	setState(st []int)
+	// compact renumbers the slots so slot i becomes perm[i]. Slots are removed if perm[i] is -1. The remaining slots
+	// keep their order.
+	compact(perm []int)
+}
+
+func newEvictor(policy EvictionPolicy) (evictor, error) {
+	switch policy {
+	case RoundRobinEviction:
+		return &roundRobinEvictor{}, nil
+	case LeastRecentlyUsedEviction:
+		return newLRUEvictor(), nil
+	case LeastFrequentlyUsedEviction:
+		return &lfuEvictor{}, nil
+	case RandomEviction:
+		return &randomEvictor{randomEvictorSeed}, nil
+	default:
+		return nil, InvalidOptionError{"WithEvictionPolicy", fmt.Sprintf("unknown eviction policy %v", policy)}
+	}
+}
+
+// roundRobinEvictor reuses slots in order.
+type roundRobinEvictor struct {
+	next int
+}
+
+func (ev *roundRobinEvictor) use(slot int, fresh bool) {}
+
+func (ev *roundRobinEvictor) victim(numSlots int) int {
+	slot := ev.next % numSlots
+	ev.next = slot + 1
+	return slot
+}
+
+func (ev *roundRobinEvictor) state() []int {
+	return []int{ev.next}
+}
+
+func (ev *roundRobinEvictor) checkState(st []int, numSlots int) error {
+	switch {
+	case len(st) > 1:
+		return fmt.Errorf("round robin eviction state has %d values instead of 1", len(st))
+	case len(st) == 1 && (st[0] < 0 || st[0] > numSlots):
+		return fmt.Errorf("next slot %d is outside of the range [0, %d]", st[0], numSlots)
+	}
+	return nil
+}
+
+func (ev *roundRobinEvictor) setState(st []int) {
+	ev.next = 0
+	if len(st) > 0 {
+		ev.next = st[0]
+	}
+}
+
+func (ev *roundRobinEvictor) compact(perm []int) {
+	// The next slot is the first remaining slot at or after the old one.
+	next := 0
+	for slot := 0; slot < ev.next && slot < len(perm); slot++ {
+		if perm[slot] >= 0 {
+			next++
+		}
+	}
+	ev.next = next
+}
+
+// lruEvictor keeps the slots in a doubly-linked list, ordered from least to most recently used.
+type lruEvictor struct {
+	prev, next []int
+	head, tail int
+}
+
+func newLRUEvictor() *lruEvictor {
+	return &lruEvictor{head: -1, tail: -1}
+}
+
+func (ev *lruEvictor) use(slot int, fresh bool) {
+	if slot == len(ev.prev) {
+		ev.prev = append(ev.prev, -1)
+		ev.next = append(ev.next, -1)
+	} else {
+		ev.unlink(slot)
+	}
+	ev.pushBack(slot)
+}
+
+func (ev *lruEvictor) unlink(slot int) {
+	prev, next := ev.prev[slot], ev.next[slot]
+	if prev >= 0 {
+		ev.next[prev] = next
+	} else {
+		ev.head = next
+	}
+	if next >= 0 {
+		ev.prev[next] = prev
+	} else {
+		ev.tail = prev
+	}
+}
+
+func (ev *lruEvictor) pushBack(slot int) {
+	ev.prev[slot], ev.next[slot] = ev.tail, -1
+	if ev.tail >= 0 {
+		ev.next[ev.tail] = slot
+	} else {
+		ev.head = slot
+	}
+	ev.tail = slot
+}
+
+func (ev *lruEvictor) victim(numSlots int) int {
+	return ev.head
+}
+
+// state returns the slots from least to most recently used.
+func (ev *lruEvictor) state() []int {
+	order := make([]int, 0, len(ev.prev))
+	for slot := ev.head; slot >= 0; slot = ev.next[slot] {
+		order = append(order, slot)
+	}
+	return order
+}
+
+func (ev *lruEvictor) checkState(order []int, numSlots int) error {
+	if len(order) != numSlots {
+		return fmt.Errorf("least recently used eviction state has %d slots instead of %d", len(order), numSlots)
+	}
+	seen := make([]bool, numSlots)
+	for _, slot := range order {
+		switch {
+		case slot < 0 || slot >= numSlots:
+			return fmt.Errorf("slot %d is outside of the range [0, %d)", slot, numSlots)
+		case seen[slot]:
+			return fmt.Errorf("slot %d is repeated", slot)
+		}
+		seen[slot] = true
+	}
+	return nil
+}
+
+func (ev *lruEvictor) setState(order []int) {
+	*ev = lruEvictor{
+		prev: make([]int, len(order)),
+		next: make([]int, len(order)),
+		head: -1,
+		tail: -1,
+	}
+	for _, slot := range order {
+		ev.pushBack(slot)
+	}
+}
+
+func (ev *lruEvictor) compact(perm []int) {
+	order := []int{}
+	for _, slot := range ev.state() {
+		if perm[slot] >= 0 {
+			order = append(order, perm[slot])
+		}
+	}
+	ev.setState(order)
+}
+
+// lfuEvictor keeps the slots in a min-heap ordered by the number of times they were used.
+type lfuEvictor struct {
+	counts []int
+	// heap contains the slots, and pos contains the position of each slot in heap.
+	heap, pos []int
+}
+
+func (ev *lfuEvictor) use(slot int, fresh bool) {
+	if slot == len(ev.counts) {
+		ev.counts = append(ev.counts, 1)
+		ev.pos = append(ev.pos, len(ev.heap))
+		heap.Push(ev, slot)
+		return
+	}
+	if fresh {
+		ev.counts[slot] = 1
+	} else {
+		ev.counts[slot]++
+	}
+	heap.Fix(ev, ev.pos[slot])
+}
+
+func (ev *lfuEvictor) victim(numSlots int) int {
+	return ev.heap[0]
+}
+
+// state returns the count for each slot.
+func (ev *lfuEvictor) state() []int {
+	return append([]int(nil), ev.counts...)
+}
+
+func (ev *lfuEvictor) checkState(counts []int, numSlots int) error {
+	if len(counts) != numSlots {
+		return fmt.Errorf("least frequently used eviction state has %d counts instead of %d", len(counts), numSlots)
+	}
+	for slot, count := range counts {
+		if count < 0 {
+			return fmt.Errorf("slot %d has negative count %d", slot, count)
+		}
+	}
+	return nil
+}
+
+func (ev *lfuEvictor) setState(counts []int) {
+	ev.counts = append([]int(nil), counts...)
+	ev.heap = make([]int, len(counts))
+	ev.pos = make([]int, len(counts))
+	for slot := range counts {
+		ev.heap[slot] = slot
+		ev.pos[slot] = slot
+	}
+	heap.Init(ev)
+}
+
+func (ev *lfuEvictor) compact(perm []int) {
+	// The remaining slots keep their order, so the counts can be appended in order.
+	counts := []int{}
+	for slot, count := range ev.counts {
+		if perm[slot] >= 0 {
+			counts = append(counts, count)
+		}
+	}
+	ev.setState(counts)
+}
+
+// Len, Less, Swap, Push, and Pop implement heap.Interface.
+func (ev *lfuEvictor) Len() int {
+	return len(ev.heap)
+}
+
+func (ev *lfuEvictor) Less(i, j int) bool {
+	si, sj := ev.heap[i], ev.heap[j]
+	if ev.counts[si] != ev.counts[sj] {
+		return ev.counts[si] < ev.counts[sj]
+	}
+	return si < sj
+}
+
+func (ev *lfuEvictor) Swap(i, j int) {
+	ev.heap[i], ev.heap[j] = ev.heap[j], ev.heap[i]
+	ev.pos[ev.heap[i]] = i
+	ev.pos[ev.heap[j]] = j
+}
+
+func (ev *lfuEvictor) Push(x interface{}) {
+	ev.heap = append(ev.heap, x.(int))
+}
+
+func (ev *lfuEvictor) Pop() interface{} {
+	slot := ev.heap[len(ev.heap)-1]
+	ev.heap = ev.heap[:len(ev.heap)-1]
+	return slot
+}
+
+// randomEvictorSeed is the initial state of every randomEvictor.
+const randomEvictorSeed = 1
+
+// randomEvictor reuses random slots. It uses the splitmix64 generator because its whole state is a single word, which
+// can be serialized.
+type randomEvictor struct {
+	rng uint64
+}
+
+func (ev *randomEvictor) use(slot int, fresh bool) {}
+
+func (ev *randomEvictor) victim(numSlots int) int {
+	ev.rng += 0x9e3779b97f4a7c15
+	z := ev.rng
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	z ^= z >> 31
+
+	// The high word of the product is in [0, numSlots).
+	slot, _ := bits.Mul64(z, uint64(numSlots))
+	return int(slot)
+}
+
+// state returns the generator's state, converted to an int so it fits with the other evictors.
+func (ev *randomEvictor) state() []int {
+	return []int{int(ev.rng)}
+}
+
+func (ev *randomEvictor) checkState(st []int, numSlots int) error {
+	if len(st) > 1 {
+		return fmt.Errorf("random eviction state has %d values instead of 1", len(st))
+	}
+	return nil
+}
+
+func (ev *randomEvictor) setState(st []int) {
+	ev.rng = randomEvictorSeed
+	if len(st) > 0 {
+		ev.rng = uint64(st[0])
+	}
+}
+
+// compact does nothing because the random choices don't depend on which slots are in use.
+func (ev *randomEvictor) compact(perm []int) {}
@@ -0,0 +1,182 @@
+package tile
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// identityTiler returns each input value as a hash, so tests can control exactly which hashes are indexed.
+type identityTiler struct{}
+
+func (identityTiler) Tile(data []float64) []uint64 {
+	hashes := make([]uint64, len(data))
+	for i, val := range data {
+		hashes[i] = uint64(val)
+	}
+	return hashes
+}
+
+// tileAll tiles each of the hashes separately and returns the index assigned to each.
+func tileAll(it *IndexingTiler, hashes ...float64) []int {
+	indices := make([]int, len(hashes))
+	for i, hash := range hashes {
+		indices[i] = it.Tile([]float64{hash})[0]
+	}
+	return indices
+}
+
+func TestIndexingTilerEvictionPolicies(t *testing.T) {
+	tests := map[EvictionPolicy]struct {
+		warmup   []float64 // tiled before the new hash, 40, which needs to evict one of 10, 20, and 30
+		expected Eviction
+	}{
+		RoundRobinEviction:          {[]float64{10, 20, 30, 10}, Eviction{10, 5}},
+		LeastRecentlyUsedEviction:   {[]float64{10, 20, 30, 10}, Eviction{20, 6}},
+		LeastFrequentlyUsedEviction: {[]float64{10, 20, 30, 30, 10, 20, 20, 10}, Eviction{30, 7}},
+	}
+
+	for policy, test := range tests {
+		t.Run(policy.String(), func(t *testing.T) {
+			it, err := NewIndexingTilerWithOffset(identityTiler{}, 5, 3, WithEvictionPolicy(policy))
+			require.NoError(t, err)
+
+			tileAll(it, test.warmup...)
+			assert.Empty(t, it.Evictions())
+			require.NoError(t, it.CheckError())
+
+			assert.Equal(t, []int{test.expected.Index}, it.Tile([]float64{40}))
+			assert.Equal(t, []Eviction{test.expected}, it.Evictions())
+			assert.Error(t, it.CheckError())
+
+			// The evicted hash no longer owns an index, so it must be assigned one by evicting another hash.
+			it.Tile([]float64{float64(test.expected.Hash)})
+			require.Len(t, it.Evictions(), 1)
+			assert.NotEqual(t, test.expected.Hash, it.Evictions()[0].Hash)
+		})
+	}
+}
+
+func TestIndexingTilerRoundRobinEvictionOrder(t *testing.T) {
+	it, err := NewIndexingTiler(identityTiler{}, 3)
+	require.NoError(t, err)
+
+	assert.Equal(t, []int{0, 1, 2, 0, 1, 2, 0}, tileAll(it, 1, 2, 3, 4, 5, 6, 7))
+	assert.Equal(t, []int{2, 0}, tileAll(it, 6, 7))
+}
+
+func TestIndexingTilerLeastFrequentlyUsedResetsCount(t *testing.T) {
+	it, err := NewIndexingTiler(identityTiler{}, 2, WithEvictionPolicy(LeastFrequentlyUsedEviction))
+	require.NoError(t, err)
+
+	tileAll(it, 1, 1, 1, 2, 2)
+	assert.Equal(t, []int{1}, it.Tile([]float64{3}), "hash 2 has fewer uses than hash 1")
+	tileAll(it, 3, 3, 3)
+	assert.Equal(t, []int{0}, it.Tile([]float64{4}), "hash 3 has more uses since it was assigned than hash 1")
+}
+
+func TestIndexingTilerRandomEviction(t *testing.T) {
+	hashes := []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 1, 2, 3, 4, 5}
+
+	var results [][]int
+	for i := 0; i < 2; i++ {
+		it, err := NewIndexingTiler(identityTiler{}, 4, WithEvictionPolicy(RandomEviction))
+		require.NoError(t, err)
+
+		result := []int{}
+		for _, hash := range hashes {
+			idx := it.Tile([]float64{hash})[0]
+			assert.GreaterOrEqual(t, idx, 0)
+			assert.Less(t, idx, 4)
+			for _, ev := range it.Evictions() {
+				assert.Equal(t, idx, ev.Index, "the evicted index should be reused")
+			}
+			result = append(result, idx)
+		}
+		results = append(results, result)
+	}
+
+	assert.Equal(t, results[0], results[1], "random eviction should be reproducible")
+}
+
+func TestIndexingTilerEvictionsWithinOneTile(t *testing.T) {
+	it, err := NewIndexingTiler(identityTiler{}, 2, WithEvictionPolicy(LeastRecentlyUsedEviction))
+	require.NoError(t, err)
+
+	assert.Equal(t, []int{0, 1, 0, 1}, it.Tile([]float64{1, 2, 3, 4}))
+	assert.Equal(t, []Eviction{{1, 0}, {2, 1}}, it.Evictions())
+	assert.Equal(t, []int{0}, it.Tile([]float64{3}))
+	assert.Empty(t, it.Evictions(), "evictions should be cleared by the next call")
+}
+
+func TestIndexingTilerOnEvict(t *testing.T) {
+	it, err := NewIndexingTiler(identityTiler{}, 2)
+	require.NoError(t, err)
+
+	evicted := []Eviction{}
+	it.OnEvict(func(oldHash uint64, index int) {
+		evicted = append(evicted, Eviction{oldHash, index})
+	})
+
+	assert.Equal(t, []int{0, 1}, tileAll(it, 1, 2))
+	assert.Empty(t, evicted)
+	assert.Equal(t, []int{0}, it.Tile([]float64{3}))
+	assert.Equal(t, []Eviction{{1, 0}}, evicted)
+
+	// Hash 1 no longer shares index 0 with hash 3. Instead it takes the next index from hash 2.
+	assert.Equal(t, []int{1}, it.Tile([]float64{1}))
+	assert.Equal(t, []Eviction{{1, 0}, {2, 1}}, evicted)
+	assert.Equal(t, []int{0, 1}, tileAll(it, 3, 1), "existing mappings should not trigger evictions")
+	assert.Len(t, evicted, 2)
+
+	it.OnEvict(nil)
+	assert.Equal(t, []int{0}, it.Tile([]float64{4}))
+	assert.Len(t, evicted, 2)
+}
+
+func TestIndexingTilerRestoresEvictionState(t *testing.T) {
+	for _, policy := range []EvictionPolicy{RoundRobinEviction, LeastRecentlyUsedEviction, LeastFrequentlyUsedEviction, RandomEviction} {
+		t.Run(policy.String(), func(t *testing.T) {
+			it, err := NewIndexingTiler(identityTiler{}, 4, WithEvictionPolicy(policy))
+			require.NoError(t, err)
+			tileAll(it, 1, 2, 3, 4, 2, 4, 1, 2, 5, 6, 4)
+
+			saved, err := it.MarshalJSON()
+			require.NoError(t, err)
+			restored, err := NewIndexingTiler(identityTiler{}, UnlimitedIndices)
+			require.NoError(t, err)
+			require.NoError(t, restored.UnmarshalJSON(saved))
+
+			sequence := []float64{7, 8, 1, 2, 3, 9, 4, 5, 6}
+			assert.Equal(t, tileAll(it, sequence...), tileAll(restored, sequence...))
+		})
+	}
+}
+
+func TestIndexingTilerCompactKeepsEvictionState(t *testing.T) {
+	for _, policy := range []EvictionPolicy{RoundRobinEviction, LeastRecentlyUsedEviction, LeastFrequentlyUsedEviction, RandomEviction} {
+		t.Run(policy.String(), func(t *testing.T) {
+			pruned, err := NewIndexingTiler(identityTiler{}, 4, WithEvictionPolicy(policy))
+			require.NoError(t, err)
+			tileAll(pruned, 1, 9, 2, 3, 9, 2, 1, 3, 1)
+			assert.Equal(t, 1, pruned.Prune(func(index int) bool { return index == 1 }))
+			_, err = pruned.Compact()
+			require.NoError(t, err)
+
+			// This IndexingTiler never saw the pruned hash, so it should now be the same.
+			expected, err := NewIndexingTiler(identityTiler{}, 4, WithEvictionPolicy(policy))
+			require.NoError(t, err)
+			tileAll(expected, 1, 2, 3, 2, 1, 3, 1)
+
+			sequence := []float64{4, 5, 6, 2, 7, 8, 1, 3}
+			assert.Equal(t, tileAll(expected, sequence...), tileAll(pruned, sequence...))
+		})
+	}
+}
+
+func TestIndexingTilerInvalidEvictionPolicy(t *testing.T) {
+	it, err := NewIndexingTiler(identityTiler{}, 4, WithEvictionPolicy(EvictionPolicy(-1)))
+	assert.IsType(t, InvalidOptionError{}, err)
+	assert.Nil(t, it)
+}
@@ -0,0 +1,39 @@
+package tile
+
+import "math/bits"
+
+// The hash used by HashTiler is implemented in this package instead of using hash/maphash so that its output depends
+// only on the seed and the hashed words. It is therefore stable across processes, machines, and Go versions. The
+// mixing steps are those used by xxHash64 for 8-byte words.
+
+const (
+	hashPrime1 uint64 = 0x9E3779B185EBCA87
+	hashPrime2 uint64 = 0xC2B2AE3D27D4EB4F
+	hashPrime3 uint64 = 0x165667B19E3779F9
+	hashPrime4 uint64 = 0x85EBCA77C2B2AE63
+	hashPrime5 uint64 = 0x27D4EB2F165667C5
+)
+
+// hashStart returns the initial hash state for the provided seed.
+func hashStart(seed uint64) uint64 {
+	return seed + hashPrime5
+}
+
+// hashWord mixes a single word into the hash state.
+func hashWord(h, w uint64) uint64 {
+	w *= hashPrime2
+	w = bits.RotateLeft64(w, 31)
+	w *= hashPrime1
+	h ^= w
+	return bits.RotateLeft64(h, 27)*hashPrime1 + hashPrime4
+}
+
+// hashFinish avalanches the hash state so every bit of input affects every bit of the result.
+func hashFinish(h uint64) uint64 {
+	h ^= h >> 33
+	h *= hashPrime2
+	h ^= h >> 29
+	h *= hashPrime3
+	h ^= h >> 32
+	return h
+}
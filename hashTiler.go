@@ -1,16 +1,229 @@
 package tile
 
 import (
-	"encoding/binary"
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
 	"fmt"
 	"hash/maphash"
 	"math"
+	"sync"
 )
 
 // HashTiler is used for tile coding.
 type HashTiler struct {
 	numTilings int
-	seed       *maphash.Seed
+	seed       uint64
+
+	// strict requires numTilings to be a power of 2.
+	strict bool
+
+	// displacement determines the offset of each tiling, unless dispVector is set.
+	displacement Displacement
+	// dispVector is the displacement vector provided by WithDisplacementVector.
+	dispVector []int
+
+	// scales contains the number of quantized units per unit of input in each dimension (i.e. numTilings divided by
+	// the tile width). Dimensions beyond its length use numTilings, which is the scale for unit tile width.
+	scales []float64
+	// mins contains the value subtracted from the input in each dimension before it is scaled. Dimensions beyond its
+	// length use 0.
+	mins []float64
+
+	// periods contains the period of each dimension provided by WithPeriods. Zero means the dimension is not periodic.
+	periods []float64
+	// wraps contains the period of each dimension in quantized units, or 0 if the dimension is not periodic.
+	wraps []int
+	// coprimes contains the numbers in [0, numTilings) which are coprime to numTilings, in increasing order. Element
+	// i%len(coprimes) is the OddDisplacement of dimension i.
+	coprimes []int
+
+	// rec records the coordinates of each hash if WithCoordinateRecording is used. It is a pointer so the recording is
+	// shared by copies of the HashTiler.
+	rec *coordinateRecorder
+}
+
+// coordinateRecorder stores the coordinates of every tile which has been hashed. It is safe for concurrent use.
+type coordinateRecorder struct {
+	sync.RWMutex
+	coords map[uint64]TileCoordinates
+}
+
+// Range describes the expected range of one input dimension, and how many tiles it should be divided into.
+type Range struct {
+	Min, Max float64
+	NumTiles int
+}
+
+// width returns the width of a tile in the range.
+func (rng Range) width() float64 {
+	return (rng.Max - rng.Min) / float64(rng.NumTiles)
+}
+
+// Displacement determines how the tilings of a HashTiler are offset from each other. Offsets are always multiples of
+// the tile width divided by the number of tilings.
+type Displacement int
+
+const (
+	// OddDisplacement offsets each tiling from the previous one by the asymmetric displacement vector (1,3,5,...).
+	// This is the default, and it is recommended by Miller and Glanz because it avoids diagonal artifacts. If
+	// numTilings is not a power of 2, the vector instead uses the numbers which are coprime to numTilings (e.g.
+	// (1,5,7,11,...) for 12 tilings), so the tilings are still offset by a different amount in every dimension.
+	OddDisplacement Displacement = iota
+
+	// UniformDisplacement offsets each tiling from the previous one by the displacement vector (1,1,1,...), so all
+	// tilings are shifted along the diagonal.
+	UniformDisplacement
+
+	// RandomDisplacement offsets each tiling by a random amount in each dimension. The offsets are determined by the
+	// seed, so they are reproducible when WithSeed is used.
+	RandomDisplacement
+)
+
+func (disp Displacement) String() string {
+	switch disp {
+	case OddDisplacement:
+		return "OddDisplacement"
+	case UniformDisplacement:
+		return "UniformDisplacement"
+	case RandomDisplacement:
+		return "RandomDisplacement"
+	default:
+		return fmt.Sprintf("Displacement(%d)", int(disp))
+	}
+}
+
+// valid returns true if disp is one of the defined Displacements.
+func (disp Displacement) valid() bool {
+	switch disp {
+	case OddDisplacement, UniformDisplacement, RandomDisplacement:
+		return true
+	default:
+		return false
+	}
+}
+
+// HashTilerOption configures optional behavior of a HashTiler. Options are provided to NewHashTiler.
+type HashTilerOption func(*HashTiler) error
+
+// WithSeed makes a HashTiler use the provided seed instead of a random one. HashTilers created with the same seed and
+// options return the same hashes for the same data, even in different processes or on different machines.
+func WithSeed(seed uint64) HashTilerOption {
+	return func(ht *HashTiler) error {
+		ht.seed = seed
+		return nil
+	}
+}
+
+// WithDisplacement sets how the tilings are offset from each other. The default is OddDisplacement.
+func WithDisplacement(disp Displacement) HashTilerOption {
+	return func(ht *HashTiler) error {
+		if !disp.valid() {
+			return InvalidOptionError{"WithDisplacement", fmt.Sprintf("unknown displacement %v", disp)}
+		}
+		ht.displacement = disp
+		ht.dispVector = nil
+		return nil
+	}
+}
+
+// WithDisplacementVector offsets each tiling from the previous one by the provided displacement vector, with one
+// element per input dimension. For example, the vector (1,3) is equivalent to OddDisplacement for 2-dimensional
+// input. If the input has more dimensions than the vector, the vector is repeated.
+func WithDisplacementVector(vec []int) HashTilerOption {
+	return func(ht *HashTiler) error {
+		if len(vec) == 0 {
+			return InvalidOptionError{"WithDisplacementVector", "the vector must not be empty"}
+		}
+		ht.dispVector = append([]int(nil), vec...)
+		return nil
+	}
+}
+
+// WithStrictNumTilings makes NewHashTiler return an InvalidNumTilingsError if numTilings is not a power of 2. With
+// OddDisplacement, only a power of 2 guarantees that the tilings are offset from each other in every dimension.
+func WithStrictNumTilings() HashTilerOption {
+	return func(ht *HashTiler) error {
+		ht.strict = true
+		return nil
+	}
+}
+
+// WithTileWidths sets the width of tiles in each input dimension. The default width is 1. If the input has more
+// dimensions than widths, the remaining dimensions use the default width.
+func WithTileWidths(widths []float64) HashTilerOption {
+	return func(ht *HashTiler) error {
+		for i, width := range widths {
+			if !(width > 0) || math.IsInf(width, 1) {
+				return InvalidOptionError{"WithTileWidths", fmt.Sprintf("width %d (%v) must be positive and finite", i, width)}
+			}
+		}
+		ht.mins = nil
+		ht.scales = make([]float64, len(widths))
+		for i, width := range widths {
+			ht.scales[i] = float64(ht.numTilings) / width
+		}
+		return nil
+	}
+}
+
+// WithRanges scales each input dimension so the Range is divided into Range.NumTiles tiles, with a tile boundary at
+// Range.Min. Input outside of the range is still tiled, but it will use tiles beyond those counted by NumTiles. If the
+// input has more dimensions than ranges, the remaining dimensions use the default tile width of 1.
+func WithRanges(ranges []Range) HashTilerOption {
+	return func(ht *HashTiler) error {
+		for i, rng := range ranges {
+			switch {
+			case rng.NumTiles < 1:
+				return InvalidOptionError{"WithRanges", fmt.Sprintf("range %d must have at least 1 tile", i)}
+			case !(rng.Max > rng.Min) || math.IsInf(rng.width(), 0):
+				return InvalidOptionError{"WithRanges", fmt.Sprintf("range %d [%v, %v] must be finite and non-empty", i, rng.Min, rng.Max)}
+			}
+		}
+		ht.mins = make([]float64, len(ranges))
+		ht.scales = make([]float64, len(ranges))
+		for i, rng := range ranges {
+			ht.mins[i] = rng.Min
+			ht.scales[i] = float64(ht.numTilings) / rng.width()
+		}
+		return nil
+	}
+}
+
+// WithPeriods makes input dimensions periodic (e.g. for angles, where -π and π are the same). The periods slice
+// contains the period of each dimension, in the input's units, or 0 if that dimension is not periodic. Tile coordinates
+// in a periodic dimension are taken modulo the number of tiles across the period, so tiles on either side of the seam
+// generalize to each other. Each period must be a whole number of tiles wide (see WithTileWidths and WithRanges).
+func WithPeriods(periods []float64) HashTilerOption {
+	return func(ht *HashTiler) error {
+		for i, period := range periods {
+			if period < 0 || math.IsNaN(period) || math.IsInf(period, 1) {
+				return InvalidOptionError{"WithPeriods", fmt.Sprintf("period %d (%v) must be positive, or 0 for no period", i, period)}
+			}
+		}
+		ht.periods = append([]float64(nil), periods...)
+		return nil
+	}
+}
+
+// WithCoordinateRecording makes the HashTiler record the tiling number and tile coordinates of every hash it returns,
+// so they can be retrieved with Coordinates. This is useful for debugging and for visualizing learned values, but
+// the recording grows with every distinct tile, and tiling is slower.
+func WithCoordinateRecording() HashTilerOption {
+	return func(ht *HashTiler) error {
+		ht.rec = &coordinateRecorder{coords: make(map[uint64]TileCoordinates)}
+		return nil
+	}
+}
+
+// InvalidOptionError is returned when an option provided to a constructor is invalid.
+type InvalidOptionError struct {
+	Option string
+	Reason string
+}
+
+func (err InvalidOptionError) Error() string {
+	return fmt.Sprintf("invalid option %s: %s", err.Option, err.Reason)
 }
 
 // InvalidNumTilingsError is returned
@@ -24,66 +237,394 @@ func (err InvalidNumTilingsError) Error() string {
 }
 
 // NewHashTiler creates a new tile coder with a unique random seed. The `numTilings` argument determines the number of
-// tilings that will be calculated. Tiling is uniform with the displacement vector (1,-1).
-func NewHashTiler(numTilings int) (*HashTiler, error) {
-	switch {
-	case numTilings < 1:
+// tilings that will be calculated. Any positive number of tilings is permitted, but a power of 2 is recommended. By
+// default, tilings are offset from each other by the displacement vector (1,3,5,...); see WithDisplacement for
+// alternatives. Options may be provided to change the default behavior, e.g. WithSeed to make the hashes reproducible.
+func NewHashTiler(numTilings int, opts ...HashTilerOption) (*HashTiler, error) {
+	if numTilings < 1 {
 		return nil, InvalidNumTilingsError{numTilings, "must be at least 1"}
-	case (numTilings & (numTilings - 1)) != 0:
-		return nil, InvalidNumTilingsError{numTilings, "must be a power of 2"}
 	}
 
-	seed := maphash.MakeSeed()
-	return &HashTiler{
+	ht := &HashTiler{
 		numTilings: numTilings,
-		seed:       &seed,
-	}, nil
+		seed:       new(maphash.Hash).Sum64(), // A zero maphash.Hash uses a random seed, so this is a random number
+	}
+	for _, opt := range opts {
+		if err := opt(ht); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := ht.setup(); err != nil {
+		return nil, err
+	}
+	return ht, nil
+}
+
+// setup checks the configuration and calculates the values which depend on it. It must be called after all options
+// are applied.
+func (ht *HashTiler) setup() error {
+	if ht.strict && (ht.numTilings&(ht.numTilings-1)) != 0 {
+		return InvalidNumTilingsError{ht.numTilings, "must be a power of 2"}
+	}
+	ht.setCoprimes()
+	return ht.setWraps()
+}
+
+// setCoprimes finds the numbers which are coprime to numTilings. For a power of 2, they are the odd numbers, so the
+// displacement vector is (1,3,5,...). Otherwise an odd component could share a factor with numTilings (e.g. 3 with 12
+// tilings), which would give several tilings the same offset in that dimension.
+func (ht *HashTiler) setCoprimes() {
+	ht.coprimes = nil
+	for val := 0; val < ht.numTilings; val++ {
+		if gcd(val, ht.numTilings) == 1 {
+			ht.coprimes = append(ht.coprimes, val)
+		}
+	}
+}
+
+// gcd returns the greatest common divisor of a and b, which must not be negative.
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// setWraps calculates the period of each dimension in quantized units. It must be called after the tile widths are
+// known, since each period must contain a whole number of tiles.
+func (ht *HashTiler) setWraps() error {
+	ht.wraps = nil
+	if len(ht.periods) == 0 {
+		return nil
+	}
+
+	ht.wraps = make([]int, len(ht.periods))
+	for i, period := range ht.periods {
+		if period == 0 {
+			continue
+		}
+		scale := float64(ht.numTilings)
+		if i < len(ht.scales) {
+			scale = ht.scales[i]
+		}
+		numTiles := period * scale / float64(ht.numTilings)
+		rounded := math.Round(numTiles)
+		if rounded < 1 || math.Abs(numTiles-rounded) > 1e-9*rounded {
+			return InvalidOptionError{"WithPeriods", fmt.Sprintf("period %d (%v) must be a whole number of tiles, not %v", i, period, numTiles)}
+		}
+		ht.wraps[i] = int(rounded) * ht.numTilings
+	}
+	return nil
+}
+
+// Seed returns the seed used by the HashTiler. Providing it to WithSeed creates a HashTiler with identical hashes.
+func (ht HashTiler) Seed() uint64 {
+	return ht.seed
 }
 
 // Tile returns a vector of length equal to `numTilings` (the argument to `NewHashTiler`). That vector contains hashes
 // describing the input data. The length of the input data is not checked, but it is generally expected that the input
 // length should always be the same for calls to the same HashTiler.
 func (ht HashTiler) Tile(data []float64) []uint64 {
-	tiles := make([]uint64, ht.numTilings)
-	hash := maphash.Hash{}
-	hash.SetSeed(*ht.seed)
-
-	qstate := make([]int, len(data))
-	offsets := make([]int, len(data))
-	coordinates := make([]uint64, len(data)+1) // one interval number per relevant dimension
-
-	// quantize state to integers (henceforth, tile widths == ht.numTilings)
-	for i := 0; i < len(data); i++ {
-		qstate[i] = int(math.Floor(data[i] * float64(ht.numTilings)))
-	}
-
-	//compute the tile numbers
-	for tileNum := 0; tileNum < ht.numTilings; tileNum++ {
-		// loop over each relevant dimension
-		for i, q := range qstate {
-			diff := q - offsets[i]
-			// find coordinates of activated tile in tiling space
-			if diff >= 0 {
-				// This shifts q toward offsets[i] so it's at a multiple of numTilings (plus the offset)
-				coordinates[i] = uint64(q - ((diff) % ht.numTilings))
-			} else {
-				// We always want to shift the value to the multiple of numTilings below its value, so when
-				// q < offsets[i], it's necessary to move it away from offsets[i] instead of toward it.
-				coordinates[i] = uint64(q - ((diff + 1) % ht.numTilings) - ht.numTilings + 1)
+	return ht.TileInto(nil, data)
+}
+
+// TileInto is like Tile, but the hashes are written into dst, which is returned resliced to length `numTilings`. If
+// the capacity of dst is too small, a new slice is allocated instead. When dst is reused, TileInto does not allocate.
+func (ht HashTiler) TileInto(dst []uint64, data []float64) []uint64 {
+	return ht.tileInto(dst, data, nil)
+}
+
+// TileWithInts is like Tile, but the ints are also hashed. They are not tiled, so data with different ints never
+// shares a tile. This is useful for inputs such as actions or categorical features.
+func (ht HashTiler) TileWithInts(data []float64, ints []int) []uint64 {
+	return ht.tileInto(nil, data, ints)
+}
+
+func (ht HashTiler) tileInto(dst []uint64, data []float64, ints []int) []uint64 {
+	if cap(dst) < ht.numTilings {
+		dst = make([]uint64, ht.numTilings)
+	}
+	tiles := dst[:ht.numTilings]
+
+	// Each element of tiles holds the running hash for that tiling until the hashes are finished.
+	for tileNum := range tiles {
+		tiles[tileNum] = hashStart(ht.seed)
+	}
+
+	// loop over each relevant dimension
+	for i, val := range data {
+		// quantize state to integers (henceforth, tile widths == ht.numTilings)
+		q := ht.quantize(val, i)
+
+		wrap := 0
+		if i < len(ht.wraps) {
+			wrap = ht.wraps[i]
+		}
+
+		// compute the coordinate of the activated tile in each tiling
+		for tileNum := range tiles {
+			coord := coordinate(q, ht.offset(tileNum, i), ht.numTilings)
+			if wrap != 0 {
+				// Since wrap is a multiple of numTilings, wrapping preserves the tiling's offset.
+				coord = floorMod(coord, wrap)
 			}
-			offsets[i] += 1 + 2*i
+			tiles[tileNum] = hashWord(tiles[tileNum], uint64(coord))
 		}
-		// add additional indices for tiling and hashing_set so they hash differently
-		coordinates[len(data)] = uint64(tileNum)
+	}
 
-		hash.Reset()
-		err := binary.Write(&hash, binary.LittleEndian, coordinates)
-		if err != nil {
-			panic(err.Error())
+	// the ints are hashed exactly, without being tiled
+	for _, val := range ints {
+		for tileNum := range tiles {
+			tiles[tileNum] = hashWord(tiles[tileNum], uint64(val))
 		}
+	}
+
+	// add additional indices for tiling and hashing_set so they hash differently
+	for tileNum := range tiles {
+		tiles[tileNum] = hashFinish(hashWord(tiles[tileNum], uint64(tileNum)))
+	}
 
-		tiles[tileNum] = hash.Sum64()
+	if ht.rec != nil {
+		ht.record(tiles, data, ints)
 	}
 
 	return tiles
 }
+
+// record stores the coordinates of each of the tiles, which were calculated from the data and ints.
+func (ht HashTiler) record(tiles []uint64, data []float64, ints []int) {
+	ht.rec.RLock()
+	known := true
+	for _, hash := range tiles {
+		if _, ok := ht.rec.coords[hash]; !ok {
+			known = false
+			break
+		}
+	}
+	ht.rec.RUnlock()
+	if known {
+		return
+	}
+
+	ht.rec.Lock()
+	defer ht.rec.Unlock()
+	for tileNum, hash := range tiles {
+		if _, ok := ht.rec.coords[hash]; ok {
+			continue
+		}
+		coords := make([]int, len(data))
+		for i, val := range data {
+			coords[i] = ht.tileCoordinate(tileNum, i, val)
+		}
+		ht.rec.coords[hash] = TileCoordinates{
+			Tiling: tileNum,
+			Coords: coords,
+			Ints:   append([]int(nil), ints...),
+		}
+	}
+}
+
+// tileCoordinate returns the integer coordinate of the tile containing val in the provided tiling and dimension. It
+// matches the coordinate hashed by tileInto, but in units of tiles instead of quantized units.
+func (ht HashTiler) tileCoordinate(tileNum, dim int, val float64) int {
+	offset := ht.offset(tileNum, dim)
+	coord := coordinate(ht.quantize(val, dim), offset, ht.numTilings)
+	if dim < len(ht.wraps) && ht.wraps[dim] != 0 {
+		coord = floorMod(coord, ht.wraps[dim])
+	}
+	// coord-offset is always a multiple of numTilings, even after wrapping.
+	return (coord - offset) / ht.numTilings
+}
+
+// Coordinates returns the tiling number and tile coordinates of a hash returned by the HashTiler. It returns false if
+// the hash was not recorded, which is always the case unless WithCoordinateRecording was used.
+func (ht HashTiler) Coordinates(hash uint64) (TileCoordinates, bool) {
+	if ht.rec == nil {
+		return TileCoordinates{}, false
+	}
+	ht.rec.RLock()
+	defer ht.rec.RUnlock()
+	tc, ok := ht.rec.coords[hash]
+	return tc, ok
+}
+
+// TileBounds returns the lower and upper boundaries of a tile in each input dimension, in the input's units. The
+// tiling and coordinates are usually provided by Coordinates. In a periodic dimension, the lower boundary is within the
+// first period (starting at 0, or Range.Min), so a tile which crosses the seam extends past the end of the period.
+func (ht HashTiler) TileBounds(tiling int, coords []int) (lower, upper []float64) {
+	lower = make([]float64, len(coords))
+	upper = make([]float64, len(coords))
+	for i, coord := range coords {
+		scale := float64(ht.numTilings)
+		if i < len(ht.scales) {
+			scale = ht.scales[i]
+		}
+		min := 0.0
+		if i < len(ht.mins) {
+			min = ht.mins[i]
+		}
+		quantized := coord*ht.numTilings + ht.offset(tiling, i)
+		lower[i] = float64(quantized)/scale + min
+		upper[i] = float64(quantized+ht.numTilings)/scale + min
+	}
+	return lower, upper
+}
+
+// quantize scales the input value in the provided dimension so tiles have width numTilings, and rounds it down.
+func (ht HashTiler) quantize(val float64, dim int) int {
+	if dim < len(ht.mins) {
+		val -= ht.mins[dim]
+	}
+	if dim < len(ht.scales) {
+		return int(math.Floor(val * ht.scales[dim]))
+	}
+	return int(math.Floor(val * float64(ht.numTilings)))
+}
+
+// offset returns the offset of a tiling in the provided dimension, in the range [0, numTilings).
+func (ht HashTiler) offset(tileNum, dim int) int {
+	if ht.dispVector != nil {
+		return floorMod(tileNum*ht.dispVector[dim%len(ht.dispVector)], ht.numTilings)
+	}
+	switch ht.displacement {
+	case UniformDisplacement:
+		return tileNum % ht.numTilings
+	case RandomDisplacement:
+		// Hash the tiling number and dimension so the offsets are random, but determined by the seed.
+		hash := hashWord(hashWord(hashStart(^ht.seed), uint64(tileNum)), uint64(dim))
+		return int(hashFinish(hash) % uint64(ht.numTilings))
+	default:
+		// For a power of 2, this is the same as (tileNum * (1 + 2*dim)) % ht.numTilings.
+		return (tileNum * ht.coprimes[dim%len(ht.coprimes)]) % ht.numTilings
+	}
+}
+
+// floorMod returns x modulo m, which is always in the range [0, m) for positive m.
+func floorMod(x, m int) int {
+	x %= m
+	if x < 0 {
+		x += m
+	}
+	return x
+}
+
+// coordinate returns the coordinate of the tile containing the quantized value q, in a tiling with tiles of width
+// numTilings that is shifted by offset.
+func coordinate(q, offset, numTilings int) int {
+	diff := q - offset
+	if diff >= 0 {
+		// This shifts q toward offset so it's at a multiple of numTilings (plus the offset)
+		return q - (diff % numTilings)
+	}
+	// We always want to shift the value to the multiple of numTilings below its value, so when
+	// q < offset, it's necessary to move it away from offset instead of toward it.
+	return q - ((diff + 1) % numTilings) - numTilings + 1
+}
+
+// hashTilerState is the serialized form of a HashTiler's configuration.
+type hashTilerState struct {
+	NumTilings   int          `json:"numTilings"`
+	Seed         uint64       `json:"seed,string"`
+	Strict       bool         `json:"strict,omitempty"`
+	Displacement Displacement `json:"displacement"`
+	DispVector   []int        `json:"displacementVector,omitempty"`
+	Scales       []float64    `json:"scales,omitempty"`
+	Mins         []float64    `json:"mins,omitempty"`
+	Periods      []float64    `json:"periods,omitempty"`
+	Recording    bool         `json:"recording,omitempty"`
+}
+
+func (ht HashTiler) state() hashTilerState {
+	return hashTilerState{
+		NumTilings:   ht.numTilings,
+		Seed:         ht.seed,
+		Strict:       ht.strict,
+		Displacement: ht.displacement,
+		DispVector:   ht.dispVector,
+		Scales:       ht.scales,
+		Mins:         ht.mins,
+		Periods:      ht.periods,
+		Recording:    ht.rec != nil,
+	}
+}
+
+func (ht *HashTiler) setState(st hashTilerState) error {
+	if st.NumTilings < 1 {
+		return InvalidNumTilingsError{st.NumTilings, "must be at least 1"}
+	}
+	if !st.Displacement.valid() {
+		return fmt.Errorf("unknown displacement %v", st.Displacement)
+	}
+	if st.DispVector != nil && len(st.DispVector) == 0 {
+		return InvalidOptionError{"WithDisplacementVector", "the vector must not be empty"}
+	}
+	for i, scale := range st.Scales {
+		if !(scale > 0) || math.IsInf(scale, 1) {
+			return fmt.Errorf("scale %d (%v) must be positive and finite", i, scale)
+		}
+	}
+	if len(st.Mins) > len(st.Scales) {
+		return fmt.Errorf("there are %d mins but only %d scales", len(st.Mins), len(st.Scales))
+	}
+
+	restored := HashTiler{
+		numTilings:   st.NumTilings,
+		seed:         st.Seed,
+		strict:       st.Strict,
+		displacement: st.Displacement,
+		dispVector:   st.DispVector,
+		scales:       st.Scales,
+		mins:         st.Mins,
+	}
+	opts := []HashTilerOption{WithPeriods(st.Periods)}
+	if st.Recording {
+		opts = append(opts, WithCoordinateRecording())
+	}
+	for _, opt := range opts {
+		if err := opt(&restored); err != nil {
+			return err
+		}
+	}
+	if err := restored.setup(); err != nil {
+		return err
+	}
+	*ht = restored
+	return nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler. It stores the seed and every option, so the restored HashTiler
+// returns the same hashes. If WithCoordinateRecording was used, the restored HashTiler also records coordinates, but
+// the coordinates that were already recorded are not stored.
+func (ht HashTiler) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(ht.state()); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler. It restores the HashTiler saved by MarshalBinary.
+func (ht *HashTiler) UnmarshalBinary(data []byte) error {
+	var st hashTilerState
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&st); err != nil {
+		return err
+	}
+	return ht.setState(st)
+}
+
+// MarshalJSON implements json.Marshaler. It stores the same configuration as MarshalBinary. The seed is stored as a
+// string, since many JSON decoders cannot represent every uint64 as a number.
+func (ht HashTiler) MarshalJSON() ([]byte, error) {
+	return json.Marshal(ht.state())
+}
+
+// UnmarshalJSON implements json.Unmarshaler. It restores the HashTiler saved by MarshalJSON.
+func (ht *HashTiler) UnmarshalJSON(data []byte) error {
+	var st hashTilerState
+	if err := json.Unmarshal(data, &st); err != nil {
+		return err
+	}
+	return ht.setState(st)
+}
@@ -2,6 +2,7 @@ package tile
 
 import (
 	"fmt"
+	"math"
 	"math/rand"
 	"strconv"
 	"testing"
@@ -10,7 +11,9 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
-var _ = Tiler(&HashTiler{}) // Conform to interface
+var _ = IntoTiler(&HashTiler{})       // Conform to interface
+var _ = IntTiler(&HashTiler{})        // Conform to interface
+var _ = CoordinateTiler(&HashTiler{}) // Conform to interface
 
 func TestHashTilerEqual(t *testing.T) {
 	tests := map[string]struct {
@@ -69,8 +72,12 @@ func TestHashTilerValidNumTiles(t *testing.T) {
 	tests := []int{
 		1,
 		2,
+		3, 5, 6, 7,
 		8,
+		10, 12,
+		127, 129,
 		512,
+		8191,
 		8192,
 	}
 
@@ -84,6 +91,39 @@ func TestHashTilerValidNumTiles(t *testing.T) {
 }
 
 func TestHashTilerInvalidNumTiles(t *testing.T) {
+	tests := []int{
+		-16, -3, -1,
+		0,
+	}
+
+	for _, numTiles := range tests {
+		t.Run(strconv.Itoa(numTiles), func(t *testing.T) {
+			ht, err := NewHashTiler(numTiles)
+			assert.IsType(t, InvalidNumTilingsError{}, err)
+			assert.Nil(t, ht)
+		})
+	}
+}
+
+func TestHashTilerStrictValidNumTiles(t *testing.T) {
+	tests := []int{
+		1,
+		2,
+		8,
+		512,
+		8192,
+	}
+
+	for _, numTiles := range tests {
+		t.Run(strconv.Itoa(numTiles), func(t *testing.T) {
+			ht, err := NewHashTiler(numTiles, WithStrictNumTilings())
+			assert.NoError(t, err)
+			assert.NotNil(t, ht)
+		})
+	}
+}
+
+func TestHashTilerStrictInvalidNumTiles(t *testing.T) {
 	tests := []int{
 		-16, -3, -1,
 		0,
@@ -94,13 +134,94 @@ func TestHashTilerInvalidNumTiles(t *testing.T) {
 
 	for _, numTiles := range tests {
 		t.Run(strconv.Itoa(numTiles), func(t *testing.T) {
-			ht, err := NewHashTiler(numTiles)
+			ht, err := NewHashTiler(numTiles, WithStrictNumTilings())
 			assert.IsType(t, InvalidNumTilingsError{}, err)
 			assert.Nil(t, ht)
 		})
 	}
 }
 
+func TestHashTilerNonPowerOfTwoTileWidth(t *testing.T) {
+	tests := map[string]int{
+		"Three":  3,
+		"Six":    6,
+		"Ten":    10,
+		"Twelve": 12,
+	}
+
+	for name, num := range tests {
+		t.Run(name, func(t *testing.T) {
+			ht, err := NewHashTiler(num)
+			require.NoError(t, err)
+
+			// Each tiling should still have unit width, so moving by 1/num in any dimension changes exactly one tiling.
+			for dim := 0; dim < 4; dim++ {
+				data := []float64{0.3, 1.7, -2.2, 5.1}
+				data[dim] = 0.5 / float64(num)
+				origin := ht.Tile(data)
+				for k := 0; k <= num; k++ {
+					data[dim] = (float64(k) + 0.5) / float64(num)
+					assert.Equalf(t, num-k, numShared(origin, ht.Tile(data)), "%d steps from the origin in dimension %d", k, dim)
+				}
+			}
+			assert.NotEqual(t, ht.Tile([]float64{0}), ht.Tile([]float64{1}))
+			assert.Equal(t, ht.Tile([]float64{0}), ht.Tile([]float64{0.99 / float64(num)}))
+		})
+	}
+}
+
+func TestHashTilerOddDisplacementForPowersOfTwo(t *testing.T) {
+	for _, num := range []int{1, 2, 4, 16} {
+		ht, err := NewHashTiler(num)
+		require.NoError(t, err)
+		for tileNum := 0; tileNum < num; tileNum++ {
+			for dim := 0; dim < 20; dim++ {
+				assert.Equal(t, (tileNum*(1+2*dim))%num, ht.offset(tileNum, dim), "%d tilings", num)
+			}
+		}
+	}
+}
+
+func TestHashTilerSameSeedIsReproducible(t *testing.T) {
+	data := [][]float64{{5}, {5.26, -3.1}, {-100.5, 0, 42}}
+
+	ht1, err := NewHashTiler(16, WithSeed(12345))
+	require.NoError(t, err)
+	ht2, err := NewHashTiler(16, WithSeed(12345))
+	require.NoError(t, err)
+
+	for _, d := range data {
+		assert.Equal(t, ht1.Tile(d), ht2.Tile(d))
+	}
+}
+
+func TestHashTilerDifferentSeedsDiffer(t *testing.T) {
+	ht1, err := NewHashTiler(16, WithSeed(1))
+	require.NoError(t, err)
+	ht2, err := NewHashTiler(16, WithSeed(2))
+	require.NoError(t, err)
+
+	assert.NotEqual(t, ht1.Tile([]float64{5}), ht2.Tile([]float64{5}))
+}
+
+func TestHashTilerRandomSeedCanBeReused(t *testing.T) {
+	ht1, err := NewHashTiler(8)
+	require.NoError(t, err)
+	ht2, err := NewHashTiler(8, WithSeed(ht1.Seed()))
+	require.NoError(t, err)
+
+	assert.Equal(t, ht1.Tile([]float64{3.14, 2.718}), ht2.Tile([]float64{3.14, 2.718}))
+}
+
+func TestHashTilerSeededHashesAreStable(t *testing.T) {
+	// These values must never change, since weights learned in one process are only valid in another if the hashes match.
+	ht, err := NewHashTiler(4, WithSeed(42))
+	require.NoError(t, err)
+
+	expected := []uint64{0xef72a528201a7e4e, 0x1c4ba551e8595e44, 0x123b9b223db519ff, 0xbc5a331ba87aa0ba}
+	assert.Equal(t, expected, ht.Tile([]float64{1.5, -2.25}))
+}
+
 func TestHashTilerCorrectTileLength(t *testing.T) {
 	numberOfTilesTest := map[string]int{
 		"One Tile":  1,
@@ -218,6 +339,402 @@ func TestHashTilerUnitGrid2DColumnsAreCorrect(t *testing.T) {
 	}
 }
 
+func TestHashTilerTileIntoMatchesTile(t *testing.T) {
+	ht, err := NewHashTiler(8)
+	require.NoError(t, err)
+
+	dst := make([]uint64, 3, 20)
+	for _, data := range [][]float64{{5}, {3.14, 2.718}, {5, 1, 4, 5, 63, 46, 37}} {
+		dst = ht.TileInto(dst, data)
+		assert.Equal(t, ht.Tile(data), dst)
+	}
+	assert.Equal(t, 20, cap(dst), "dst should have been reused")
+}
+
+func TestHashTilerTileIntoDoesNotAllocate(t *testing.T) {
+	ht, err := NewHashTiler(16)
+	require.NoError(t, err)
+	data := []float64{5, 1, 4, 5, 63, 46, 37}
+	dst := make([]uint64, 16)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		dst = ht.TileInto(dst, data)
+	})
+	assert.Zero(t, allocs)
+}
+
+// numShared returns the number of tilings for which the two vectors of hashes are in the same tile.
+func numShared(a, b []uint64) int {
+	shared := 0
+	for i := range a {
+		if a[i] == b[i] {
+			shared++
+		}
+	}
+	return shared
+}
+
+func TestHashTilerDisplacementGeneralization1D(t *testing.T) {
+	const num = 8
+	tests := map[string]HashTilerOption{
+		"Odd":     WithDisplacement(OddDisplacement),
+		"Uniform": WithDisplacement(UniformDisplacement),
+		"Vector":  WithDisplacementVector([]int{3}),
+	}
+
+	for name, opt := range tests {
+		t.Run(name, func(t *testing.T) {
+			ht, err := NewHashTiler(num, opt)
+			require.NoError(t, err)
+
+			// Generalization should decrease linearly, by one tiling for each 1/num step away from the origin.
+			origin := ht.Tile([]float64{0.5 / num})
+			for k := 0; k <= num; k++ {
+				other := ht.Tile([]float64{(float64(k) + 0.5) / num})
+				assert.Equalf(t, num-k, numShared(origin, other), "%d steps from the origin", k)
+			}
+		})
+	}
+}
+
+func TestHashTilerDisplacementGeneralizationRandom(t *testing.T) {
+	const num = 16
+	ht, err := NewHashTiler(num, WithDisplacement(RandomDisplacement))
+	require.NoError(t, err)
+
+	for dim := 0; dim < 3; dim++ {
+		// Generalization still decreases with distance, though not necessarily linearly.
+		point := []float64{0.5 / num, 0.5 / num, 0.5 / num}
+		origin := ht.Tile(point)
+		lastShared := num
+		for k := 0; k <= num; k++ {
+			point[dim] = (float64(k) + 0.5) / num
+			shared := numShared(origin, ht.Tile(point))
+			assert.LessOrEqualf(t, shared, lastShared, "dim %d, %d steps from the origin", dim, k)
+			lastShared = shared
+		}
+		assert.Zerof(t, lastShared, "dim %d should share no tiles after moving one tile width", dim)
+	}
+}
+
+func TestHashTilerDisplacementGeneralizationDiagonal(t *testing.T) {
+	const num = 8
+	tests := map[string]struct {
+		opt      HashTilerOption
+		expected []int // the number of tiles shared with the origin after each diagonal step
+	}{
+		"Odd":     {WithDisplacement(OddDisplacement), []int{8, 6, 4, 4, 3, 1, 1, 1, 0}},
+		"Uniform": {WithDisplacement(UniformDisplacement), []int{8, 7, 6, 5, 4, 3, 2, 1, 0}},
+		"Vector":  {WithDisplacementVector([]int{1, 1}), []int{8, 7, 6, 5, 4, 3, 2, 1, 0}},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ht, err := NewHashTiler(num, test.opt)
+			require.NoError(t, err)
+
+			origin := ht.Tile([]float64{0.5 / num, 0.5 / num})
+			for k, expected := range test.expected {
+				x := (float64(k) + 0.5) / num
+				assert.Equalf(t, expected, numShared(origin, ht.Tile([]float64{x, x})), "%d steps from the origin", k)
+			}
+		})
+	}
+}
+
+func TestHashTilerDisplacementVectorMatchesMode(t *testing.T) {
+	tests := map[string]struct {
+		vec  []int
+		disp Displacement
+	}{
+		"Odd":     {[]int{1, 3, 5}, OddDisplacement},
+		"Uniform": {[]int{1}, UniformDisplacement},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ht1, err := NewHashTiler(16, WithSeed(3), WithDisplacementVector(test.vec))
+			require.NoError(t, err)
+			ht2, err := NewHashTiler(16, WithSeed(3), WithDisplacement(test.disp))
+			require.NoError(t, err)
+
+			for _, data := range [][]float64{{5.1, 2.7, -3.3}, {0, 0.1, 0.2}, {9.9, -4.2, 1.01}} {
+				assert.Equal(t, ht1.Tile(data), ht2.Tile(data))
+			}
+		})
+	}
+}
+
+func TestHashTilerInvalidDisplacement(t *testing.T) {
+	tests := map[string]HashTilerOption{
+		"Unknown mode": WithDisplacement(Displacement(-1)),
+		"Empty vector": WithDisplacementVector(nil),
+	}
+
+	for name, opt := range tests {
+		t.Run(name, func(t *testing.T) {
+			ht, err := NewHashTiler(4, opt)
+			assert.IsType(t, InvalidOptionError{}, err)
+			assert.Nil(t, ht)
+		})
+	}
+}
+
+func TestHashTilerTileWidths(t *testing.T) {
+	widths := []float64{2, 0.25}
+	ht, err := NewHashTiler(4, WithSeed(9), WithTileWidths(widths))
+	require.NoError(t, err)
+	unscaled, err := NewHashTiler(4, WithSeed(9))
+	require.NoError(t, err)
+
+	// Scaling inside the HashTiler should be the same as dividing the input by the widths.
+	for _, data := range [][]float64{{0.1, 0.1}, {3.3, -2.01}, {-7.9, 5.55}, {1.1, 0.3, 42.2}} {
+		scaled := append([]float64(nil), data...)
+		for i := range widths {
+			scaled[i] /= widths[i]
+		}
+		assert.Equal(t, unscaled.Tile(scaled), ht.Tile(data), data)
+	}
+}
+
+func TestHashTilerRanges(t *testing.T) {
+	ranges := []Range{{-math.Pi, math.Pi, 8}, {10, 20, 5}}
+	ht, err := NewHashTiler(4, WithSeed(9), WithRanges(ranges))
+	require.NoError(t, err)
+	unscaled, err := NewHashTiler(4, WithSeed(9))
+	require.NoError(t, err)
+
+	// Scaling inside the HashTiler should be the same as shifting and scaling the input to the tile width.
+	for _, data := range [][]float64{{0.1, 10.1}, {3.1, 19.2}, {-3.13, 14.41}, {1.1, 12.2, 42.2}} {
+		scaled := append([]float64(nil), data...)
+		for i, rng := range ranges {
+			scaled[i] = (scaled[i] - rng.Min) * float64(rng.NumTiles) / (rng.Max - rng.Min)
+		}
+		assert.Equal(t, unscaled.Tile(scaled), ht.Tile(data), data)
+	}
+}
+
+func TestHashTilerRangesMaxIndices(t *testing.T) {
+	ranges := []Range{{-1, 1, 4}, {0, 100, 3}}
+	numTilings := 4
+	ht, err := NewHashTiler(numTilings, WithRanges(ranges))
+	require.NoError(t, err)
+
+	// Sweeping the whole input range must not produce more hashes than MaxIndicesForScaledRanges predicts.
+	hashes := map[uint64]bool{}
+	for x := -1.0; x <= 1; x += 0.01 {
+		for y := 0.0; y <= 100; y += 0.5 {
+			for _, hash := range ht.Tile([]float64{x, y}) {
+				hashes[hash] = true
+			}
+		}
+	}
+	assert.LessOrEqual(t, len(hashes), MaxIndicesForScaledRanges(ranges, numTilings))
+	assert.Greater(t, len(hashes), MaxIndicesForRanges([]int{3, 2}, numTilings))
+}
+
+func TestHashTilerInvalidScaling(t *testing.T) {
+	tests := map[string]HashTilerOption{
+		"Zero width":      WithTileWidths([]float64{1, 0}),
+		"Negative width":  WithTileWidths([]float64{-1}),
+		"NaN width":       WithTileWidths([]float64{math.NaN()}),
+		"Infinite width":  WithTileWidths([]float64{math.Inf(1)}),
+		"No tiles":        WithRanges([]Range{{0, 1, 0}}),
+		"Empty range":     WithRanges([]Range{{1, 1, 4}}),
+		"Backwards range": WithRanges([]Range{{1, 0, 4}}),
+		"Unbounded range": WithRanges([]Range{{math.Inf(-1), 0, 4}}),
+	}
+
+	for name, opt := range tests {
+		t.Run(name, func(t *testing.T) {
+			ht, err := NewHashTiler(4, opt)
+			assert.IsType(t, InvalidOptionError{}, err)
+			assert.Nil(t, ht)
+		})
+	}
+}
+
+func TestHashTilerPeriodicSeam(t *testing.T) {
+	const num = 8
+	ranges := []Range{{-math.Pi, math.Pi, 6}, {0, 1, 1}}
+	periodic, err := NewHashTiler(num, WithRanges(ranges), WithPeriods([]float64{2 * math.Pi, 0}))
+	require.NoError(t, err)
+	bounded, err := NewHashTiler(num, WithRanges(ranges))
+	require.NoError(t, err)
+
+	below := []float64{math.Pi - 0.001, 0.5}
+	above := []float64{-math.Pi + 0.001, 0.5}
+	assert.Zero(t, numShared(bounded.Tile(below), bounded.Tile(above)), "without a period, the seam should separate tiles")
+	assert.GreaterOrEqual(t, numShared(periodic.Tile(below), periodic.Tile(above)), num-1, "with a period, the seam should generalize")
+}
+
+func TestHashTilerPeriodicEquivalence(t *testing.T) {
+	ht, err := NewHashTiler(4, WithTileWidths([]float64{0.5, 1}), WithPeriods([]float64{3, 0}))
+	require.NoError(t, err)
+
+	for _, x := range []float64{0.1, 1.3, 2.61, -0.7} {
+		for _, k := range []float64{-2, -1, 1, 5} {
+			assert.Equalf(t, ht.Tile([]float64{x, 2.2}), ht.Tile([]float64{x + 3*k, 2.2}), "%v should equal %v periods away", x, k)
+		}
+		assert.NotEqual(t, ht.Tile([]float64{x, 2.2}), ht.Tile([]float64{x, 5.2}), "the second dimension is not periodic")
+	}
+}
+
+func TestHashTilerInvalidPeriods(t *testing.T) {
+	tests := map[string][]HashTilerOption{
+		"Negative":          {WithPeriods([]float64{-1})},
+		"NaN":               {WithPeriods([]float64{math.NaN()})},
+		"Fractional tiles":  {WithPeriods([]float64{2.5})},
+		"Less than a tile":  {WithTileWidths([]float64{2}), WithPeriods([]float64{1})},
+		"Misaligned ranges": {WithRanges([]Range{{0, 1, 4}}), WithPeriods([]float64{1.1})},
+	}
+
+	for name, opts := range tests {
+		t.Run(name, func(t *testing.T) {
+			ht, err := NewHashTiler(4, opts...)
+			assert.IsType(t, InvalidOptionError{}, err)
+			assert.Nil(t, ht)
+		})
+	}
+}
+
+func TestHashTilerTileWithInts(t *testing.T) {
+	ht, err := NewHashTiler(8)
+	require.NoError(t, err)
+	data := []float64{3.14, 2.718}
+
+	assert.Equal(t, ht.Tile(data), ht.TileWithInts(data, nil), "no ints should be the same as Tile")
+	assert.Equal(t, ht.TileWithInts(data, []int{3}), ht.TileWithInts([]float64{3.15, 2.72}, []int{3}), "nearby data with the same ints should match")
+	assert.Zero(t, numShared(ht.TileWithInts(data, []int{3}), ht.TileWithInts(data, []int{4})), "different ints should never share tiles")
+	assert.Zero(t, numShared(ht.TileWithInts(data, []int{1, 2}), ht.TileWithInts(data, []int{2, 1})), "the order of ints should matter")
+	assert.Zero(t, numShared(ht.TileWithInts(data, []int{3}), ht.Tile(data)))
+}
+
+func TestHashTilerCoordinateRecording(t *testing.T) {
+	ht, err := NewHashTiler(2, WithCoordinateRecording())
+	require.NoError(t, err)
+
+	hashes := ht.TileWithInts([]float64{1.5, -2.25}, []int{7})
+	tc, ok := ht.Coordinates(hashes[0])
+	require.True(t, ok)
+	assert.Equal(t, TileCoordinates{Tiling: 0, Coords: []int{1, -3}, Ints: []int{7}}, tc)
+	tc, ok = ht.Coordinates(hashes[1])
+	require.True(t, ok)
+	assert.Equal(t, TileCoordinates{Tiling: 1, Coords: []int{1, -3}, Ints: []int{7}}, tc, "offset by (0.5, 1.5)")
+
+	_, ok = ht.Coordinates(hashes[0] + 1)
+	assert.False(t, ok, "unseen hashes should not have coordinates")
+
+	plain, err := NewHashTiler(2, WithSeed(ht.Seed()))
+	require.NoError(t, err)
+	plain.Tile([]float64{1.5, -2.25})
+	_, ok = plain.Coordinates(hashes[0])
+	assert.False(t, ok, "coordinates should only be recorded when requested")
+}
+
+func TestHashTilerTileBoundsContainData(t *testing.T) {
+	tests := map[string][]HashTilerOption{
+		"Default":  {},
+		"Widths":   {WithTileWidths([]float64{0.3, 2})},
+		"Ranges":   {WithRanges([]Range{{-1, 1, 5}, {10, 20, 3}})},
+		"Random":   {WithDisplacement(RandomDisplacement)},
+		"Periodic": {WithTileWidths([]float64{0.5}), WithPeriods([]float64{3})},
+	}
+
+	for name, opts := range tests {
+		t.Run(name, func(t *testing.T) {
+			ht, err := NewHashTiler(4, append(opts, WithCoordinateRecording())...)
+			require.NoError(t, err)
+
+			for i := 0; i < 20; i++ {
+				data := []float64{rand.Float64()*2.9 + 0.05, rand.Float64()*10 + 10}
+				for tiling, hash := range ht.Tile(data) {
+					tc, ok := ht.Coordinates(hash)
+					require.True(t, ok)
+					require.Equal(t, tiling, tc.Tiling)
+					lower, upper := ht.TileBounds(tc.Tiling, tc.Coords)
+					for dim, val := range data {
+						if name == "Periodic" && dim == 0 && val < lower[dim] {
+							val += 3 // the tile crosses the seam, so its lower bound is near the end of the period
+						}
+						assert.LessOrEqual(t, lower[dim], val+1e-9, "tiling %d dimension %d", tiling, dim)
+						assert.Greater(t, upper[dim], val-1e-9, "tiling %d dimension %d", tiling, dim)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestHashTilerRestores(t *testing.T) {
+	type marshaler func(*HashTiler) ([]byte, error)
+	type unmarshaler func(*HashTiler, []byte) error
+	formats := map[string]struct {
+		marshal   marshaler
+		unmarshal unmarshaler
+	}{
+		"Binary": {(*HashTiler).MarshalBinary, (*HashTiler).UnmarshalBinary},
+		"JSON":   {(*HashTiler).MarshalJSON, (*HashTiler).UnmarshalJSON},
+	}
+	configs := map[string][]HashTilerOption{
+		"Default":      {},
+		"Seed":         {WithSeed(math.MaxUint64 - 3)},
+		"Uniform":      {WithDisplacement(UniformDisplacement), WithStrictNumTilings()},
+		"Random":       {WithDisplacement(RandomDisplacement)},
+		"Vector":       {WithDisplacementVector([]int{1, 5})},
+		"Widths":       {WithTileWidths([]float64{0.3, 2})},
+		"Ranges":       {WithRanges([]Range{{-1, 1, 5}, {10, 20, 3}}), WithPeriods([]float64{2, 0})},
+		"Coordinates":  {WithCoordinateRecording()},
+		"All the rest": {WithTileWidths([]float64{0.25}), WithPeriods([]float64{1}), WithDisplacementVector([]int{3})},
+	}
+
+	for formatName, format := range formats {
+		for name, opts := range configs {
+			t.Run(formatName+"/"+name, func(t *testing.T) {
+				ht, err := NewHashTiler(8, opts...)
+				require.NoError(t, err)
+				saved, err := format.marshal(ht)
+				require.NoError(t, err)
+
+				restored := &HashTiler{}
+				require.NoError(t, format.unmarshal(restored, saved))
+				assert.Equal(t, ht.Seed(), restored.Seed())
+				for i := 0; i < 10; i++ {
+					data := makeValues(2)
+					hashes := ht.Tile(data)
+					assert.Equal(t, hashes, restored.Tile(data))
+					_, recorded := restored.Coordinates(hashes[0])
+					assert.Equal(t, name == "Coordinates", recorded)
+				}
+			})
+		}
+	}
+}
+
+func TestHashTilerUnmarshalInvalid(t *testing.T) {
+	tests := map[string]string{
+		"Not JSON":           `{"numTilings"`,
+		"No tilings":         `{"numTilings":0,"seed":"1"}`,
+		"Not strict":         `{"numTilings":3,"seed":"1","strict":true}`,
+		"Displacement":       `{"numTilings":4,"seed":"1","displacement":7}`,
+		"Empty vector":       `{"numTilings":4,"seed":"1","displacementVector":[]}`,
+		"Negative scale":     `{"numTilings":4,"seed":"1","scales":[-1]}`,
+		"Too many mins":      `{"numTilings":4,"seed":"1","scales":[1],"mins":[1,2]}`,
+		"Negative period":    `{"numTilings":4,"seed":"1","periods":[-2]}`,
+		"Fractional period":  `{"numTilings":4,"seed":"1","periods":[2.5]}`,
+		"Seed is not string": `{"numTilings":4,"seed":1}`,
+	}
+
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			ht, err := NewHashTiler(2, WithSeed(5))
+			require.NoError(t, err)
+			assert.Error(t, ht.UnmarshalJSON([]byte(data)))
+			assert.Equal(t, uint64(5), ht.Seed(), "the HashTiler should not change")
+		})
+	}
+}
+
 func verifyGridSlice(t *testing.T, gridOfHashes [][]uint64) {
 	// For each box in this row (or column), find the hash which it has in common with all other boxes in the row (or column), and delete it
 	lastHashes := gridOfHashes[len(gridOfHashes)-1]
@@ -293,9 +810,11 @@ func BenchmarkHashTiler(b *testing.B) {
 		b.Run(bench.name, func(b *testing.B) {
 			v := makeValues(bench.values)
 			ht, _ := NewHashTiler(bench.tiles)
+			tiles := []uint64{}
+			b.ReportAllocs()
 			b.ResetTimer()
 			for i := 0; i < b.N; i++ {
-				_ = ht.Tile(v)
+				tiles = ht.TileInto(tiles, v)
 			}
 		})
 	}
@@ -0,0 +1,168 @@
+package tile
+
+import (
+	"container/heap"
+	"errors"
+)
+
+// IndexAllocator assigns indices to the hashes of one or more IndexingTilers. Every IndexingTiler has an allocator,
+// but by default it is not shared. When several IndexingTilers share an IndexAllocator (see
+// NewIndexingTilerWithAllocator), they draw indices from one range with one budget, instead of each using a
+// separate range that might fill up while the others are empty. When all indices are in use, an index is taken from
+// whichever IndexingTiler's hash is chosen by the EvictionPolicy.
+// Like IndexingTiler, it is not safe for concurrent use.
+type IndexAllocator struct {
+	// indexSize is the maximum number of indices to be assigned.
+	indexSize int
+	// offset is the offset added to every index.
+	offset int
+	// currentIndex stores the number that will be used for the next index, until all indices are in use.
+	currentIndex int
+
+	// policy determines which index is reused when all indices have been used, and evict implements it.
+	policy EvictionPolicy
+	evict  evictor
+	// owners stores the owner of each index (without the offset).
+	owners []indexOwner
+	// free is a min-heap of the slots below currentIndex which were released, so they are reused in order.
+	free freeSlots
+}
+
+// indexOwner is the hash which is assigned an index, and the IndexingTiler which stores it.
+type indexOwner struct {
+	it   *IndexingTiler
+	hash uint64
+}
+
+// errSharedAllocator is returned when an operation would affect other IndexingTilers that share an IndexAllocator.
+var errSharedAllocator = errors.New("not supported for an IndexingTiler with a shared IndexAllocator")
+
+// NewIndexAllocator creates a new IndexAllocator that assigns indices in the range [offset, indexSize+offset), which
+// can be shared by IndexingTilers. If indexSize is UnlimitedIndices, then the number of indices is unlimited.
+// Otherwise it must be at least 1. The policy determines which index is reused once all indices are in use.
+func NewIndexAllocator(offset, indexSize int, policy EvictionPolicy) (*IndexAllocator, error) {
+	if indexSize < 1 {
+		return nil, InvalidMemorySizeError{indexSize, "must be at least 1"}
+	}
+	evict, err := newEvictor(policy)
+	if err != nil {
+		return nil, err
+	}
+	return &IndexAllocator{
+		indexSize:    indexSize,
+		offset:       offset,
+		currentIndex: offset,
+		policy:       policy,
+		evict:        evict,
+	}, nil
+}
+
+// NumAssigned returns the number of indices which are assigned to a hash. Indices removed by IndexingTiler.Prune are
+// not included.
+func (alloc IndexAllocator) NumAssigned() int {
+	return alloc.currentIndex - alloc.offset - len(alloc.free)
+}
+
+// full returns true if every index has been assigned.
+func (alloc IndexAllocator) full() bool {
+	return alloc.indexSize != UnlimitedIndices && alloc.currentIndex >= alloc.indexSize+alloc.offset
+}
+
+// use records that the index was returned by Tile.
+func (alloc *IndexAllocator) use(idx int) {
+	alloc.evict.use(idx-alloc.offset, false)
+}
+
+// assign gives an index to the hash of the provided IndexingTiler. The lowest released index is used first. If all
+// indices are in use, one is reused according to the EvictionPolicy, and its previous owner is returned with evicted
+// set to true. The caller is responsible for removing the previous owner's hash from its map.
+func (alloc *IndexAllocator) assign(it *IndexingTiler, hash uint64) (idx int, prev indexOwner, evicted bool) {
+	var slot int
+	switch {
+	case len(alloc.free) > 0:
+		slot = heap.Pop(&alloc.free).(int)
+		alloc.owners[slot] = indexOwner{it, hash}
+	case alloc.full():
+		slot = alloc.evict.victim(alloc.indexSize)
+		prev = alloc.owners[slot]
+		evicted = true
+		alloc.owners[slot] = indexOwner{it, hash}
+	default:
+		slot = alloc.currentIndex - alloc.offset
+		alloc.currentIndex++
+		alloc.owners = append(alloc.owners, indexOwner{it, hash})
+	}
+	alloc.evict.use(slot, true)
+	return slot + alloc.offset, prev, evicted
+}
+
+// release removes the owner of an index, so it can be assigned to the next new hash.
+func (alloc *IndexAllocator) release(idx int) {
+	slot := idx - alloc.offset
+	alloc.owners[slot] = indexOwner{}
+	heap.Push(&alloc.free, slot)
+}
+
+// setFree finds the slots without an owner. It must be called after the owners are restored.
+func (alloc *IndexAllocator) setFree() {
+	alloc.free = nil
+	for slot, owner := range alloc.owners {
+		if owner.it == nil {
+			// The slots are in increasing order, so this is a valid heap.
+			alloc.free = append(alloc.free, slot)
+		}
+	}
+}
+
+// compact renumbers the indices in use so they are consecutive, and returns the new index of each old index. Both are
+// relative to the offset, so element i of the returned slice is for the index offset+i. Indices which are not in use
+// are -1.
+func (alloc *IndexAllocator) compact() []int {
+	perm := make([]int, len(alloc.owners))
+	owners := alloc.owners[:0]
+	for slot, owner := range alloc.owners {
+		if owner.it == nil {
+			perm[slot] = -1
+			continue
+		}
+		perm[slot] = len(owners)
+		owners = append(owners, owner)
+	}
+	for i := len(owners); i < len(alloc.owners); i++ {
+		alloc.owners[i] = indexOwner{}
+	}
+	alloc.evict.compact(perm)
+
+	for slot, owner := range owners {
+		owner.it.mp[owner.hash] = slot + alloc.offset
+	}
+	alloc.owners = owners
+	alloc.free = nil
+	alloc.currentIndex = alloc.offset + len(owners)
+	return perm
+}
+
+// freeSlots implements heap.Interface for the released slots.
+type freeSlots []int
+
+func (fs freeSlots) Len() int {
+	return len(fs)
+}
+
+func (fs freeSlots) Less(i, j int) bool {
+	return fs[i] < fs[j]
+}
+
+func (fs freeSlots) Swap(i, j int) {
+	fs[i], fs[j] = fs[j], fs[i]
+}
+
+func (fs *freeSlots) Push(x interface{}) {
+	*fs = append(*fs, x.(int))
+}
+
+func (fs *freeSlots) Pop() interface{} {
+	slot := (*fs)[len(*fs)-1]
+	*fs = (*fs)[:len(*fs)-1]
+	return slot
+}
@@ -0,0 +1,109 @@
+package tile
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSharedIndexTilers(t *testing.T, alloc *IndexAllocator, num int) []*IndexingTiler {
+	its := make([]*IndexingTiler, num)
+	for i := range its {
+		var err error
+		its[i], err = NewIndexingTilerWithAllocator(identityTiler{}, alloc)
+		require.NoError(t, err)
+	}
+	return its
+}
+
+func TestIndexAllocatorSharesIndices(t *testing.T) {
+	alloc, err := NewIndexAllocator(10, UnlimitedIndices, RoundRobinEviction)
+	require.NoError(t, err)
+	its := newSharedIndexTilers(t, alloc, 2)
+
+	// Indices are dense across both tilers, even though they see the same hashes.
+	assert.Equal(t, []int{10, 11}, its[0].Tile([]float64{1, 2}))
+	assert.Equal(t, []int{12, 13, 14}, its[1].Tile([]float64{1, 2, 3}))
+	assert.Equal(t, []int{10, 11, 15}, its[0].Tile([]float64{1, 2, 3}))
+	assert.Equal(t, []int{12, 13, 14}, its[1].Tile([]float64{1, 2, 3}))
+	assert.Equal(t, 6, alloc.NumAssigned())
+	assert.NoError(t, its[0].CheckError())
+	assert.NoError(t, its[1].CheckError())
+}
+
+func TestIndexAllocatorSharesBudget(t *testing.T) {
+	alloc, err := NewIndexAllocator(0, 4, RoundRobinEviction)
+	require.NoError(t, err)
+	its := newSharedIndexTilers(t, alloc, 2)
+
+	// The first tiler can use more than half of the budget if the second doesn't need it.
+	assert.Equal(t, []int{0, 1, 2}, tileAll(its[0], 1, 2, 3))
+	assert.Equal(t, []int{3}, tileAll(its[1], 1))
+	assert.NoError(t, its[0].CheckError())
+	assert.NoError(t, its[1].CheckError())
+
+	// The next hash takes an index from the other tiler.
+	assert.Equal(t, []int{0}, its[1].Tile([]float64{2}))
+	assert.Equal(t, []Eviction{{1, 0}}, its[1].Evictions())
+	assert.Error(t, its[1].CheckError())
+	assert.NoError(t, its[0].CheckError(), "overflow is reported by the tiler which needed a new index")
+
+	// The evicted hash needs a new index, which it takes from its own tiler.
+	assert.Equal(t, []int{1}, its[0].Tile([]float64{1}))
+	assert.Equal(t, []Eviction{{2, 1}}, its[0].Evictions())
+	assert.Equal(t, []int{0, 3}, tileAll(its[1], 2, 1), "the second tiler's hashes are unaffected")
+}
+
+func TestIndexAllocatorOnEvictCallsOwner(t *testing.T) {
+	alloc, err := NewIndexAllocator(0, 2, LeastRecentlyUsedEviction)
+	require.NoError(t, err)
+	its := newSharedIndexTilers(t, alloc, 2)
+
+	evicted := make([][]Eviction, len(its))
+	for i, it := range its {
+		i := i
+		it.OnEvict(func(oldHash uint64, index int) {
+			evicted[i] = append(evicted[i], Eviction{oldHash, index})
+		})
+	}
+
+	tileAll(its[0], 1)
+	tileAll(its[1], 1)
+	tileAll(its[0], 1)
+	assert.Equal(t, []int{1}, its[0].Tile([]float64{2}))
+	assert.Empty(t, evicted[0])
+	assert.Equal(t, []Eviction{{1, 1}}, evicted[1], "the owner of the evicted hash should be notified")
+}
+
+func TestIndexAllocatorRejectsSharedOptions(t *testing.T) {
+	alloc, err := NewIndexAllocator(0, 4, RoundRobinEviction)
+	require.NoError(t, err)
+
+	_, err = NewIndexingTilerWithAllocator(identityTiler{}, alloc, WithEvictionPolicy(LeastRecentlyUsedEviction))
+	assert.Error(t, err)
+
+	it, err := NewIndexingTilerWithAllocator(identityTiler{}, alloc)
+	require.NoError(t, err)
+	_, err = it.MarshalBinary()
+	assert.Error(t, err)
+	_, err = it.MarshalJSON()
+	assert.Error(t, err)
+}
+
+func TestIndexAllocatorInvalidSize(t *testing.T) {
+	for _, size := range []int{0, -1} {
+		alloc, err := NewIndexAllocator(0, size, RoundRobinEviction)
+		assert.IsType(t, InvalidMemorySizeError{}, err)
+		assert.Nil(t, alloc)
+
+		it, err := NewIndexingTilerWithOffset(identityTiler{}, 5, size)
+		assert.IsType(t, InvalidMemorySizeError{}, err)
+		assert.Nil(t, it)
+	}
+}
+
+func TestIndexAllocatorInvalidPolicy(t *testing.T) {
+	_, err := NewIndexAllocator(0, 4, EvictionPolicy(-1))
+	assert.Error(t, err)
+}
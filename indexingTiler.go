@@ -1,13 +1,20 @@
 package tile
 
 import (
-	"errors"
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
 	"math"
+	"math/bits"
 )
 
 // UnlimitedIndices can be provided to NewIndexingTiler to indicate there is no maximum number of indices.
 const UnlimitedIndices = math.MaxInt64
 
+// DropUnknown can be provided to IndexingTiler.Freeze to indicate that unseen tiles should be left out of the output.
+const DropUnknown = math.MinInt64
+
 // IndexingTiler is used for tile coding when a slice of indexes is desired. It runs slower than HashTiler.
 type IndexingTiler struct {
 	// ht is the underlying HashTiler that generates the hashes.
@@ -15,36 +22,90 @@ type IndexingTiler struct {
 
 	// mp stores an index for each hash that has been seen so far.
 	mp map[uint64]int
-	// indexSize is the maximum number of indices to be stored in the map.
-	indexSize int
-	// currentIndex stores the number that will be used for the next index. (Therefore, it's also the number
-	// of elements currently in the map, unless overflow has occurred or offset is used.)
-	currentIndex int
-	// offset is the offset added to every index. Indices are stored with this offset.
-	offset int
+	// alloc assigns indices to new hashes. If shared, other IndexingTilers also use it.
+	alloc  *IndexAllocator
+	shared bool
+
+	// evictions stores the evictions which occurred during the most recent call to Tile.
+	evictions []Eviction
+	// onEvict is called whenever a hash loses its index.
+	onEvict func(oldHash uint64, index int)
+
+	// frozen prevents new indices from being assigned. Instead, unseen hashes are given the unknown index.
+	frozen  bool
+	unknown int
+
+	// calls is the number of calls to Tile, and misses is the number of times a hash was assigned an index.
+	calls, misses int
+	// tilings counts the hits and misses for each position in the output of Tile.
+	tilings []TilingStats
+	// growth stores the value of misses after each call numbered by a power of 2, so growth[k] is from call 1<<k.
+	growth []int
+	// overflows is the number of times an index was reused since the error was cleared, and firstOverflowCall is the
+	// call during which the first of those overflows occurred.
+	overflows, firstOverflowCall int
+
+	// hashes is reused by TileInto to store the output of ht.
+	hashes []uint64
+}
+
+// IndexingTilerOption configures optional behavior of an IndexingTiler. Options are provided to NewIndexingTiler.
+type IndexingTilerOption func(*IndexingTiler) error
 
-	// err stores any errors that occurred due to an index overflow
-	err error
+// WithEvictionPolicy sets which index is reused for a new tile once all indices are in use. The default is
+// RoundRobinEviction. It cannot be used with NewIndexingTilerWithAllocator, since the IndexAllocator has a policy.
+func WithEvictionPolicy(policy EvictionPolicy) IndexingTilerOption {
+	return func(it *IndexingTiler) error {
+		if it.shared {
+			return InvalidOptionError{"WithEvictionPolicy", "the policy of a shared IndexAllocator cannot be changed"}
+		}
+		alloc, err := NewIndexAllocator(it.alloc.offset, it.alloc.indexSize, policy)
+		if err != nil {
+			return err
+		}
+		it.alloc = alloc
+		return nil
+	}
 }
 
 // NewIndexingTiler creates a new Indexing Tiler, which returns a slice of indexes based on the tiles' hashes.
 // Hashes are calculated by HashTiler. See its documentation for further details regarding usage.
-// If indexSize is UnlimitedIndices, then the number of indices is unlimited. Otherwise, the error is provided
-// through CheckError().
-func NewIndexingTiler(til Tiler, indexSize int) (*IndexingTiler, error) {
-	return NewIndexingTilerWithOffset(til, 0, indexSize)
+// If indexSize is UnlimitedIndices, then the number of indices is unlimited. Otherwise, it must be at least 1, and the
+// error is provided through CheckError().
+func NewIndexingTiler(til Tiler, indexSize int, opts ...IndexingTilerOption) (*IndexingTiler, error) {
+	return NewIndexingTilerWithOffset(til, 0, indexSize, opts...)
 }
 
 // NewIndexingTilerWithOffset creates a new indexing tiler, but with an offset added to each provided index.
 // Indices output by Tile will be in the range [offset, indexSize+offset).
-func NewIndexingTilerWithOffset(til Tiler, offset, indexSize int) (*IndexingTiler, error) {
-	return &IndexingTiler{
-		ht:           til,
-		indexSize:    indexSize,
-		offset:       offset,
-		currentIndex: offset,
-		mp:           make(map[uint64]int),
-	}, nil
+func NewIndexingTilerWithOffset(til Tiler, offset, indexSize int, opts ...IndexingTilerOption) (*IndexingTiler, error) {
+	alloc, err := NewIndexAllocator(offset, indexSize, RoundRobinEviction)
+	if err != nil {
+		return nil, err
+	}
+	return newIndexingTiler(til, alloc, false, opts)
+}
+
+// NewIndexingTilerWithAllocator creates a new indexing tiler which gets its indices from the provided IndexAllocator.
+// If several IndexingTilers share an allocator, they share its range of indices, and a tile seen by one of them can
+// lose its index to a tile seen by another.
+func NewIndexingTilerWithAllocator(til Tiler, alloc *IndexAllocator, opts ...IndexingTilerOption) (*IndexingTiler, error) {
+	return newIndexingTiler(til, alloc, true, opts)
+}
+
+func newIndexingTiler(til Tiler, alloc *IndexAllocator, shared bool, opts []IndexingTilerOption) (*IndexingTiler, error) {
+	it := &IndexingTiler{
+		ht:     til,
+		mp:     make(map[uint64]int),
+		alloc:  alloc,
+		shared: shared,
+	}
+	for _, opt := range opts {
+		if err := opt(it); err != nil {
+			return nil, err
+		}
+	}
+	return it, nil
 }
 
 // Tile returns a vector of indices describing the input data.
@@ -52,31 +113,481 @@ func NewIndexingTilerWithOffset(til Tiler, offset, indexSize int) (*IndexingTile
 // The length of the input data is not checked, but it is generally expected that the input
 // length should always be the same for calls to the same IndexingTiler.
 func (it *IndexingTiler) Tile(data []float64) []int {
-	hashes := it.ht.Tile(data)
+	return it.TileInto(nil, data)
+}
+
+// TileInto is like Tile, but the indices are written into dst, which is returned resliced to the number of indices. If
+// the capacity of dst is too small, a new slice is allocated instead. If the underlying Tiler is an IntoTiler, its
+// hashes are also stored in a reused buffer, so TileInto does not allocate unless a new index is stored.
+func (it *IndexingTiler) TileInto(dst []int, data []float64) []int {
+	it.hashes = tileInto(it.ht, it.hashes, data)
+	return it.indices(dst, it.hashes)
+}
+
+// TileWithInts is like Tile, but the ints are also hashed without being tiled. See IntTiler for details. If the
+// underlying Tiler is not an IntTiler, the ints are mixed into each of its hashes instead.
+func (it *IndexingTiler) TileWithInts(data []float64, ints []int) []int {
+	return it.indices(nil, tileWithInts(it.ht, data, ints))
+}
 
-	indices := make([]int, len(hashes))
+// indices writes the index of each hash into dst, reusing it if its capacity is large enough.
+func (it *IndexingTiler) indices(dst []int, hashes []uint64) []int {
+	if cap(dst) < len(hashes) {
+		dst = make([]int, len(hashes))
+	}
+	indices := dst[:len(hashes)]
+	it.evictions = it.evictions[:0]
+	if it.frozen {
+		return it.frozenIndices(indices, hashes)
+	}
+
+	it.calls++
+	if len(it.tilings) < len(hashes) {
+		it.tilings = append(it.tilings, make([]TilingStats, len(hashes)-len(it.tilings))...)
+	}
 	for i, hash := range hashes {
+		idx, ok := it.mp[hash]
+		if ok {
+			it.alloc.use(idx)
+			it.tilings[i].Hits++
+		} else {
+			idx = it.newIndex(hash)
+			it.tilings[i].Misses++
+		}
+		indices[i] = idx
+	}
+	if it.calls&(it.calls-1) == 0 {
+		it.growth = append(it.growth, it.misses)
+	}
+
+	return indices
+}
+
+// frozenIndices writes the index of each hash into indices without changing the IndexingTiler.
+func (it *IndexingTiler) frozenIndices(indices []int, hashes []uint64) []int {
+	num := 0
+	for _, hash := range hashes {
 		idx, ok := it.mp[hash]
 		if !ok {
-			if it.indexSize != UnlimitedIndices && it.currentIndex >= it.indexSize+it.offset {
-				it.err = errors.New("Too many tile indices were used, so one is being overwritten")
-				it.currentIndex = it.offset
+			if it.unknown == DropUnknown {
+				continue
 			}
-			idx = it.currentIndex
-			it.mp[hash] = it.currentIndex
-			it.currentIndex++
+			idx = it.unknown
+		}
+		indices[num] = idx
+		num++
+	}
+	return indices[:num]
+}
+
+// Freeze stops the IndexingTiler from changing, which is useful when evaluating a trained agent. Tiles which have been
+// seen before keep their indices, but unseen tiles are not assigned an index. Instead, they are given the unknown
+// index (e.g. -1, or an index reserved for unknown tiles), or they are left out of the output if unknown is
+// DropUnknown. Usage statistics and eviction policies are not updated while frozen.
+func (it *IndexingTiler) Freeze(unknown int) {
+	it.frozen = true
+	it.unknown = unknown
+}
+
+// Unfreeze undoes Freeze, so unseen tiles are assigned indices again.
+func (it *IndexingTiler) Unfreeze() {
+	it.frozen = false
+	it.unknown = 0
+}
+
+// Frozen returns true if Freeze has been called (without a subsequent call to Unfreeze).
+func (it IndexingTiler) Frozen() bool {
+	return it.frozen
+}
 
+// newIndex assigns an index to the hash. If all indices are in use, one is reused according to the EvictionPolicy.
+func (it *IndexingTiler) newIndex(hash uint64) int {
+	it.misses++
+	idx, prev, evicted := it.alloc.assign(it, hash)
+	if evicted {
+		if it.overflows == 0 {
+			it.firstOverflowCall = it.calls
+		}
+		it.overflows++
+		delete(prev.it.mp, prev.hash)
+		it.evictions = append(it.evictions, Eviction{Hash: prev.hash, Index: idx})
+		if prev.it.onEvict != nil {
+			prev.it.onEvict(prev.hash, idx)
 		}
-		indices[i] = idx
 	}
 
-	return indices
+	it.mp[hash] = idx
+	return idx
+}
+
+// Coordinates returns the tiling number and tile coordinates represented by an index. This requires the underlying
+// Tiler to be a CoordinateTiler which recorded the tile (e.g. a HashTiler created with WithCoordinateRecording). It
+// returns false if the index is not currently assigned to a tile seen by this IndexingTiler, or if its coordinates
+// are unknown.
+func (it *IndexingTiler) Coordinates(index int) (TileCoordinates, bool) {
+	ct, ok := it.ht.(CoordinateTiler)
+	if !ok {
+		return TileCoordinates{}, false
+	}
+	slot := index - it.alloc.offset
+	if slot < 0 || slot >= len(it.alloc.owners) || it.alloc.owners[slot].it != it {
+		return TileCoordinates{}, false
+	}
+	return ct.Coordinates(it.alloc.owners[slot].hash)
+}
+
+// OnEvict sets a function which is called whenever a hash loses its index so the index can be given to a new hash.
+// The old hash is removed from the IndexingTiler, so if it is seen again it will be assigned a different index. The
+// function is called during Tile, before the index is returned for the new hash, so it can reset any values that were
+// learned for the index (e.g. the weight and eligibility trace). Only one function is stored; nil removes it.
+// With a shared IndexAllocator, the function is called for the IndexingTiler whose hash lost its index, even if the
+// index was taken by a different IndexingTiler.
+func (it *IndexingTiler) OnEvict(fn func(oldHash uint64, index int)) {
+	it.onEvict = fn
+}
+
+// Evictions returns the hashes which lost their indices during the most recent call to Tile (or TileInto or
+// TileWithInts), so any learned values associated with those indices can be reset. The returned slice is only valid
+// until the next call to Tile. With a shared IndexAllocator, the hashes may belong to other IndexingTilers.
+func (it IndexingTiler) Evictions() []Eviction {
+	return it.evictions
 }
 
-// CheckError returns an error if more indices were used than expected.
+// Reset clears every index, so the IndexingTiler is the same as when it was created (with the same options and
+// OnEvict function). It returns an error if the IndexAllocator is shared, since that would affect the other
+// IndexingTilers.
+func (it *IndexingTiler) Reset() error {
+	if it.shared {
+		return errSharedAllocator
+	}
+	alloc, err := NewIndexAllocator(it.alloc.offset, it.alloc.indexSize, it.alloc.policy)
+	if err != nil {
+		return err
+	}
+	*it = IndexingTiler{
+		ht:      it.ht,
+		mp:      make(map[uint64]int),
+		alloc:   alloc,
+		onEvict: it.onEvict,
+		hashes:  it.hashes,
+	}
+	return nil
+}
+
+// Prune removes the index of every tile for which remove returns true, so those tiles will be assigned new indices if
+// they are seen again. The pruned indices are assigned to new tiles before any tile is evicted, starting with the
+// lowest. OnEvict is not called. Prune returns the number of indices that were removed.
+func (it *IndexingTiler) Prune(remove func(index int) bool) int {
+	num := 0
+	for hash, idx := range it.mp {
+		if remove(idx) {
+			delete(it.mp, hash)
+			it.alloc.release(idx)
+			num++
+		}
+	}
+	return num
+}
+
+// Compact renumbers the indices which are in use so they are consecutive, starting at the offset. This is useful after
+// Prune, so the indices in use are a contiguous range. It returns the old to new permutation of indices relative to
+// the offset: the index that was offset+i is now offset+perm[i], or perm[i] is -1 if it's no longer used. It has an
+// element for every index from the offset up to the largest index that was assigned, so learned values can be moved
+// with e.g. `newWeights[offset+perm[i]] = weights[offset+i]` for each perm[i] >= 0. Indices are only moved to smaller
+// values, so the values can also be moved within the same slice if i increases. Compact returns an error if the
+// IndexAllocator is shared.
+func (it *IndexingTiler) Compact() ([]int, error) {
+	if it.shared {
+		return nil, errSharedAllocator
+	}
+	return it.alloc.compact(), nil
+}
+
+// IndexingStats describes how an IndexingTiler has used its indices. It is returned by IndexingTiler.Stats.
+type IndexingStats struct {
+	// IndexSize is the number of indices available, or UnlimitedIndices.
+	IndexSize int
+	// Used is the number of indices currently assigned to this IndexingTiler's tiles.
+	Used int
+	// Remaining is the number of indices which are not assigned to a tile, or UnlimitedIndices. With a shared
+	// IndexAllocator, this is the number remaining for all of the IndexingTilers which share it.
+	Remaining int
+	// Calls is the number of calls to Tile (or TileInto or TileWithInts), not counting calls while frozen.
+	Calls int
+	// Hits is the number of tiles which already had an index, and Misses is the number which needed a new one. A tile
+	// which lost its index and was seen again is a miss again.
+	Hits, Misses int
+	// Overflows is the number of times an index was taken from another tile since ClearError was called.
+	Overflows int
+	// Tilings contains the hits and misses for each position in the output of Tile. For a HashTiler, that's each
+	// tiling. For an AggregateTiler, the positions of its Tilers' outputs are in order.
+	Tilings []TilingStats
+	// GrowthExponent describes how quickly misses are growing, based on the second half of the calls so far. It is b
+	// in the power law Misses = a*Calls^b, so 1 means new tiles are still seen at a constant rate, and 0 means no new
+	// tiles are being seen.
+	GrowthExponent float64
+}
+
+// TilingStats describes the hits and misses for one position in the output of an IndexingTiler.
+type TilingStats struct {
+	Hits   int `json:"hits"`
+	Misses int `json:"misses"`
+}
+
+// Occupancy returns the fraction of indices which are in use, or 0 if the number of indices is unlimited.
+func (stats IndexingStats) Occupancy() float64 {
+	if stats.IndexSize == UnlimitedIndices {
+		return 0
+	}
+	return float64(stats.Used) / float64(stats.IndexSize)
+}
+
+// ProjectedMisses estimates the number of misses there will be after the provided total number of calls, assuming
+// misses keep growing according to GrowthExponent. Without overflows, that's the number of indices needed.
+func (stats IndexingStats) ProjectedMisses(calls int) int {
+	if stats.Calls == 0 || calls <= stats.Calls {
+		return stats.Misses
+	}
+	return int(math.Ceil(float64(stats.Misses) * math.Pow(float64(calls)/float64(stats.Calls), stats.GrowthExponent)))
+}
+
+// ProjectedOccupancy estimates the fraction of indices that will be needed after the provided total number of calls,
+// based on ProjectedMisses. A value greater than 1 means indexSize is too small, so tiles will overflow. It returns 0
+// if the number of indices is unlimited.
+func (stats IndexingStats) ProjectedOccupancy(calls int) float64 {
+	if stats.IndexSize == UnlimitedIndices {
+		return 0
+	}
+	return float64(stats.ProjectedMisses(calls)) / float64(stats.IndexSize)
+}
+
+// Stats returns statistics describing how the IndexingTiler has used its indices, which is useful for choosing
+// indexSize. Unlike MaxIndices, these describe the tiles that were actually seen.
+func (it IndexingTiler) Stats() IndexingStats {
+	stats := IndexingStats{
+		IndexSize:      it.alloc.indexSize,
+		Used:           len(it.mp),
+		Remaining:      UnlimitedIndices,
+		Calls:          it.calls,
+		Misses:         it.misses,
+		Overflows:      it.overflows,
+		Tilings:        append([]TilingStats(nil), it.tilings...),
+		GrowthExponent: it.growthExponent(),
+	}
+	if it.alloc.indexSize != UnlimitedIndices {
+		stats.Remaining = it.alloc.indexSize - it.alloc.NumAssigned()
+	}
+	for _, tiling := range it.tilings {
+		stats.Hits += tiling.Hits
+	}
+	return stats
+}
+
+// growthExponent estimates b in misses = a*calls^b by comparing the current misses to the misses at the latest power
+// of 2 calls which is at most half of the current calls.
+func (it IndexingTiler) growthExponent() float64 {
+	switch {
+	case it.misses == 0:
+		return 0
+	case it.calls < 2:
+		return 1
+	}
+	k := bits.Len(uint(it.calls/2)) - 1
+	if k >= len(it.growth) || it.growth[k] == 0 {
+		return 1
+	}
+	return math.Log(float64(it.misses)/float64(it.growth[k])) / math.Log(float64(it.calls)/float64(int(1)<<k))
+}
+
+// IndexOverflowError is returned by IndexingTiler.CheckError when a tile needed an index after all indices were used,
+// so an index was taken from another tile.
+type IndexOverflowError struct {
+	// IndexSize is the number of indices available.
+	IndexSize int
+	// Overflows is the number of times an index was taken from another tile.
+	Overflows int
+	// DistinctHashes is the number of times a hash without an index was assigned one. A hash which lost its index and
+	// was seen again is counted again.
+	DistinctHashes int
+	// FirstOverflowCall is the number of the call to Tile (starting from 1) during which the first overflow occurred.
+	FirstOverflowCall int
+}
+
+func (err IndexOverflowError) Error() string {
+	return fmt.Sprintf("too many tile indices were used: %d distinct hashes for %d indices caused %d overflows, starting at call %d",
+		err.DistinctHashes, err.IndexSize, err.Overflows, err.FirstOverflowCall)
+}
+
+// NumIndices returns the maximum number of indices (i.e. indexSize), which may be UnlimitedIndices. With a shared
+// IndexAllocator, all of the IndexingTilers which share it have the same range of indices.
+func (it IndexingTiler) NumIndices() int {
+	return it.alloc.indexSize
+}
+
+// CheckError returns an IndexOverflowError if more indices were used than expected.
 // There is no reason to check it if indexSize is UnlimitedIndices.
 func (it IndexingTiler) CheckError() error {
-	return it.err
+	if it.overflows == 0 {
+		return nil
+	}
+	return IndexOverflowError{
+		IndexSize:         it.alloc.indexSize,
+		Overflows:         it.overflows,
+		DistinctHashes:    it.misses,
+		FirstOverflowCall: it.firstOverflowCall,
+	}
+}
+
+// ClearError clears the error returned by CheckError, so it only reports overflows that occur after this call.
+func (it *IndexingTiler) ClearError() {
+	it.overflows = 0
+	it.firstOverflowCall = 0
+}
+
+// indexingTilerState is the serialized form of an IndexingTiler. It contains everything except the underlying Tiler.
+type indexingTilerState struct {
+	Indices      map[uint64]int `json:"indices"`
+	IndexSize    int            `json:"indexSize"`
+	CurrentIndex int            `json:"currentIndex"`
+	Offset       int            `json:"offset"`
+
+	Calls             int `json:"calls"`
+	Misses            int `json:"misses"`
+	Overflows         int `json:"overflows,omitempty"`
+	FirstOverflowCall int `json:"firstOverflowCall,omitempty"`
+
+	Policy   EvictionPolicy `json:"policy"`
+	Eviction []int          `json:"eviction,omitempty"`
+
+	Frozen  bool `json:"frozen,omitempty"`
+	Unknown int  `json:"unknown,omitempty"`
+
+	Tilings []TilingStats `json:"tilings,omitempty"`
+	Growth  []int         `json:"growth,omitempty"`
+}
+
+func (it IndexingTiler) state() (indexingTilerState, error) {
+	if it.shared {
+		return indexingTilerState{}, errSharedAllocator
+	}
+	return indexingTilerState{
+		Indices:      it.mp,
+		IndexSize:    it.alloc.indexSize,
+		CurrentIndex: it.alloc.currentIndex,
+		Offset:       it.alloc.offset,
+
+		Calls:             it.calls,
+		Misses:            it.misses,
+		Overflows:         it.overflows,
+		FirstOverflowCall: it.firstOverflowCall,
+
+		Policy:   it.alloc.policy,
+		Eviction: it.alloc.evict.state(),
+
+		Frozen:  it.frozen,
+		Unknown: it.unknown,
+
+		Tilings: it.tilings,
+		Growth:  it.growth,
+	}, nil
+}
+
+func (it *IndexingTiler) setState(st indexingTilerState) error {
+	if it.shared {
+		return errSharedAllocator
+	}
+	alloc, err := NewIndexAllocator(st.Offset, st.IndexSize, st.Policy)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case st.CurrentIndex < st.Offset:
+		return fmt.Errorf("current index %d is less than the offset %d", st.CurrentIndex, st.Offset)
+	case st.IndexSize != UnlimitedIndices && st.CurrentIndex-st.Offset > st.IndexSize:
+		return fmt.Errorf("current index %d is beyond the range [%d, %d)", st.CurrentIndex, st.Offset, st.Offset+st.IndexSize)
+	}
+	alloc.currentIndex = st.CurrentIndex
+
+	// Every hash in the map owns its index, so the owners can be recovered from the map.
+	alloc.owners = make([]indexOwner, st.CurrentIndex-st.Offset)
+	for hash, idx := range st.Indices {
+		if idx < st.Offset || idx >= st.CurrentIndex {
+			return fmt.Errorf("index %d of hash %d is outside of the range [%d, %d)", idx, hash, st.Offset, st.CurrentIndex)
+		}
+		if owner := alloc.owners[idx-st.Offset]; owner.it != nil {
+			return fmt.Errorf("hashes %d and %d both have index %d", owner.hash, hash, idx)
+		}
+		alloc.owners[idx-st.Offset] = indexOwner{it, hash}
+	}
+	alloc.setFree()
+
+	if err := alloc.evict.checkState(st.Eviction, len(alloc.owners)); err != nil {
+		return err
+	}
+	alloc.evict.setState(st.Eviction)
+
+	it.mp = st.Indices
+	if it.mp == nil {
+		it.mp = make(map[uint64]int)
+	}
+	it.alloc = alloc
+	it.calls = st.Calls
+	it.misses = st.Misses
+	it.tilings = st.Tilings
+	it.growth = st.Growth
+	it.overflows = st.Overflows
+	it.firstOverflowCall = st.FirstOverflowCall
+	it.evictions = nil
+	it.frozen = st.Frozen
+	it.unknown = st.Unknown
+	return nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler. It stores every hash that has been assigned an index, along with
+// the counters needed to continue assigning indices. The underlying Tiler is not stored. An IndexingTiler with a
+// shared IndexAllocator cannot be marshaled, since its indices depend on the other IndexingTilers.
+func (it IndexingTiler) MarshalBinary() ([]byte, error) {
+	st, err := it.state()
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(st); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler. It restores the state saved by MarshalBinary, so previously
+// seen tiles are given the same indices as before. Since the underlying Tiler is not stored, the IndexingTiler should
+// be created with a Tiler that produces the same hashes as the original (e.g. a HashTiler created WithSeed, or one
+// restored by HashTiler.UnmarshalBinary).
+func (it *IndexingTiler) UnmarshalBinary(data []byte) error {
+	var st indexingTilerState
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&st); err != nil {
+		return err
+	}
+	return it.setState(st)
+}
+
+// MarshalJSON implements json.Marshaler. It stores the same state as MarshalBinary.
+func (it IndexingTiler) MarshalJSON() ([]byte, error) {
+	st, err := it.state()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(st)
+}
+
+// UnmarshalJSON implements json.Unmarshaler. It restores the state saved by MarshalJSON. See UnmarshalBinary for
+// details.
+func (it *IndexingTiler) UnmarshalJSON(data []byte) error {
+	var st indexingTilerState
+	if err := json.Unmarshal(data, &st); err != nil {
+		return err
+	}
+	return it.setState(st)
 }
 
 // MaxIndices returns the maximum number of indices with a given maximum range of input data, number of dimensions
@@ -103,3 +614,27 @@ func MaxIndicesForRanges(ranges []int, numTilings int) int {
 	result *= numTilings
 	return result
 }
+
+// MaxIndicesForScaledRanges is like MaxIndicesForRanges, but it uses the same description of the input as the
+// WithRanges option to NewHashTiler, so the input is assumed to be scaled by the HashTiler.
+func MaxIndicesForScaledRanges(ranges []Range, numTilings int) int {
+	tiles := make([]int, len(ranges))
+	for i, rng := range ranges {
+		tiles[i] = rng.NumTiles
+	}
+	return MaxIndicesForRanges(tiles, numTilings)
+}
+
+// MaxIndicesForTileWidths is like MaxIndicesForRanges, but it uses the same tile widths as the WithTileWidths option
+// to NewHashTiler. The ranges slice contains the maximum range for each input value, in the input's units.
+func MaxIndicesForTileWidths(ranges, widths []float64, numTilings int) int {
+	tiles := make([]int, len(ranges))
+	for i, val := range ranges {
+		width := 1.0
+		if i < len(widths) {
+			width = widths[i]
+		}
+		tiles[i] = int(math.Ceil(val / width))
+	}
+	return MaxIndicesForRanges(tiles, numTilings)
+}
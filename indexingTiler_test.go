@@ -1,14 +1,17 @@
 package tile
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
-var _ = IndexTiler(&IndexingTiler{}) // Conform to interface
+var _ = IndexTiler(&IndexingTiler{})      // Conform to interface
+var _ = SizedIndexTiler(&IndexingTiler{}) // Conform to interface
 
 func newUnlimitedIndexTiler(tiles int) (IndexTiler, error) {
 	til, err := NewHashTiler(tiles)
@@ -147,6 +150,65 @@ func TestIndexingTilerUnequalAppearEqualWithSmallMap(t *testing.T) {
 	}
 }
 
+func TestIndexingTilerOverflowError(t *testing.T) {
+	it, err := NewIndexingTilerWithOffset(identityTiler{}, 10, 3)
+	require.NoError(t, err)
+
+	tileAll(it, 1, 2, 3, 1)
+	require.NoError(t, it.CheckError())
+	it.Tile([]float64{4, 5})
+	tileAll(it, 6, 1)
+
+	err = it.CheckError()
+	var overflow IndexOverflowError
+	require.True(t, errors.As(err, &overflow))
+	assert.Equal(t, IndexOverflowError{IndexSize: 3, Overflows: 4, DistinctHashes: 7, FirstOverflowCall: 5}, overflow)
+
+	it.ClearError()
+	assert.NoError(t, it.CheckError())
+	tileAll(it, 2, 6)
+	require.True(t, errors.As(it.CheckError(), &overflow))
+	assert.Equal(t, IndexOverflowError{IndexSize: 3, Overflows: 1, DistinctHashes: 8, FirstOverflowCall: 8}, overflow)
+}
+
+func TestIndexingTilerFreeze(t *testing.T) {
+	tests := map[string]struct {
+		unknown  int
+		expected []int
+	}{
+		"Negative":       {-1, []int{0, -1, 1, -1}},
+		"Shared":         {99, []int{0, 99, 1, 99}},
+		"Drop":           {DropUnknown, []int{0, 1}},
+		"Existing index": {1, []int{0, 1, 1, 1}},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			it, err := NewIndexingTiler(identityTiler{}, 4)
+			require.NoError(t, err)
+			it.Tile([]float64{1, 2})
+			before, err := it.MarshalJSON()
+			require.NoError(t, err)
+
+			it.Freeze(test.unknown)
+			assert.True(t, it.Frozen())
+			assert.Equal(t, test.expected, it.Tile([]float64{1, 3, 2, 4}))
+			assert.Equal(t, test.expected, it.TileInto(make([]int, 4), []float64{1, 3, 2, 4}))
+
+			after, err := it.MarshalJSON()
+			require.NoError(t, err)
+			it.Unfreeze()
+			unfrozen, err := it.MarshalJSON()
+			require.NoError(t, err)
+			assert.NotEqual(t, before, after, "the frozen state should be saved")
+			assert.Equal(t, before, unfrozen, "nothing else should change while frozen")
+
+			assert.False(t, it.Frozen())
+			assert.Equal(t, []int{0, 2, 1, 3}, it.Tile([]float64{1, 3, 2, 4}))
+		})
+	}
+}
+
 func TestIndexingTilerCorrectTileLength(t *testing.T) {
 	numberOfTilesTest := map[string]int{
 		"One Tile":  1,
@@ -321,6 +383,322 @@ func deleteIndex(indices []int, index int) []int {
 	return newIndices
 }
 
+func TestIndexingTilerTileIntoMatchesTile(t *testing.T) {
+	it, err := newUnlimitedIndexTiler(4)
+	require.NoError(t, err)
+
+	dst := []int{}
+	for _, data := range [][]float64{{4.99}, {5.24}, {5.25}, {5.49}} {
+		dst = it.(*IndexingTiler).TileInto(dst, data)
+		assert.Equal(t, it.Tile(data), dst)
+	}
+}
+
+func TestIndexingTilerTileIntoDoesNotAllocateForSeenTiles(t *testing.T) {
+	it, err := newUnlimitedIndexTiler(16)
+	require.NoError(t, err)
+	data := []float64{5, 1, 4, 5, 63, 46, 37}
+	dst := it.Tile(data)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		dst = it.(*IndexingTiler).TileInto(dst, data)
+	})
+	assert.Zero(t, allocs)
+}
+
+func TestIndexingTilerTileWithInts(t *testing.T) {
+	it, err := newUnlimitedIndexTiler(4)
+	require.NoError(t, err)
+	tiler := it.(*IndexingTiler)
+
+	action3 := tiler.TileWithInts([]float64{5.24}, []int{3})
+	action4 := tiler.TileWithInts([]float64{5.24}, []int{4})
+	assert.Equal(t, []int{0, 1, 2, 3}, action3)
+	assert.Equal(t, []int{4, 5, 6, 7}, action4)
+	assert.Equal(t, action3, tiler.TileWithInts([]float64{5.2}, []int{3}))
+	assert.Equal(t, []int{8, 9, 10, 11}, tiler.Tile([]float64{5.24}))
+}
+
+func TestIndexingTilerRestoresState(t *testing.T) {
+	type marshaler func(*IndexingTiler) ([]byte, error)
+	type unmarshaler func(*IndexingTiler, []byte) error
+	tests := map[string]struct {
+		marshal   marshaler
+		unmarshal unmarshaler
+	}{
+		"Binary": {(*IndexingTiler).MarshalBinary, (*IndexingTiler).UnmarshalBinary},
+		"JSON":   {(*IndexingTiler).MarshalJSON, (*IndexingTiler).UnmarshalJSON},
+	}
+	seen := [][]float64{{4.99}, {5.24}, {5.25}, {5.49}}
+	unseen := [][]float64{{7.3}, {-2.1}}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			til, err := NewHashTiler(4, WithSeed(7))
+			require.NoError(t, err)
+			it, err := NewIndexingTilerWithOffset(til, 3, 20)
+			require.NoError(t, err)
+			for _, data := range seen {
+				it.Tile(data)
+			}
+
+			saved, err := test.marshal(it)
+			require.NoError(t, err)
+
+			til, err = NewHashTiler(4, WithSeed(7))
+			require.NoError(t, err)
+			restored, err := NewIndexingTiler(til, UnlimitedIndices)
+			require.NoError(t, err)
+			require.NoError(t, test.unmarshal(restored, saved))
+
+			for _, data := range append(seen, unseen...) {
+				assert.Equal(t, it.Tile(data), restored.Tile(data), data)
+			}
+			assert.Equal(t, it.CheckError(), restored.CheckError())
+			assert.Equal(t, it.Stats(), restored.Stats())
+		})
+	}
+}
+
+func TestIndexingTilerRestoresError(t *testing.T) {
+	til, err := NewHashTiler(4, WithSeed(7))
+	require.NoError(t, err)
+	it, err := NewIndexingTiler(til, 2)
+	require.NoError(t, err)
+	it.Tile([]float64{1})
+	require.Error(t, it.CheckError())
+
+	saved, err := it.MarshalBinary()
+	require.NoError(t, err)
+
+	restored, err := NewIndexingTiler(til, 2)
+	require.NoError(t, err)
+	require.NoError(t, restored.UnmarshalBinary(saved))
+	assert.EqualError(t, restored.CheckError(), it.CheckError().Error())
+}
+
+func TestIndexingTilerUnmarshalInvalid(t *testing.T) {
+	tests := map[string]string{
+		"Not JSON":              `{"indices"`,
+		"No indices":            `{"indexSize":0,"currentIndex":0}`,
+		"Before offset":         `{"indexSize":2,"currentIndex":1,"offset":3}`,
+		"Beyond range":          `{"indices":{"1":3},"indexSize":1,"currentIndex":5}`,
+		"Index outside range":   `{"indices":{"1":4},"indexSize":8,"currentIndex":2}`,
+		"Repeated index":        `{"indices":{"1":0,"2":0},"indexSize":2,"currentIndex":1}`,
+		"Unknown policy":        `{"indexSize":2,"currentIndex":0,"policy":9}`,
+		"Round robin negative":  `{"indices":{"1":0},"indexSize":2,"currentIndex":1,"eviction":[-7]}`,
+		"Round robin too large": `{"indices":{"1":0},"indexSize":2,"currentIndex":1,"eviction":[2]}`,
+		"Round robin too long":  `{"indices":{"1":0},"indexSize":2,"currentIndex":1,"eviction":[0,1]}`,
+		"LRU slot":              `{"indices":{"1":0},"indexSize":2,"currentIndex":1,"policy":1,"eviction":[5]}`,
+		"LRU repeated slot":     `{"indices":{"1":0,"2":1},"indexSize":2,"currentIndex":2,"policy":1,"eviction":[0,0]}`,
+		"LRU missing slot":      `{"indices":{"1":0,"2":1},"indexSize":2,"currentIndex":2,"policy":1,"eviction":[1]}`,
+		"LFU missing count":     `{"indices":{"1":0,"2":1},"indexSize":2,"currentIndex":2,"policy":2,"eviction":[3]}`,
+		"LFU negative count":    `{"indices":{"1":0},"indexSize":2,"currentIndex":1,"policy":2,"eviction":[-1]}`,
+		"Random too long":       `{"indexSize":2,"currentIndex":0,"policy":3,"eviction":[1,2]}`,
+	}
+
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			it, err := NewIndexingTiler(identityTiler{}, 4)
+			require.NoError(t, err)
+			it.Tile([]float64{7})
+			assert.Error(t, it.UnmarshalJSON([]byte(data)))
+			assert.Equal(t, []int{0, 1}, it.Tile([]float64{7, 8}), "the IndexingTiler should not change")
+		})
+	}
+}
+
+func TestIndexingTilerReset(t *testing.T) {
+	it, err := NewIndexingTilerWithOffset(identityTiler{}, 3, 2, WithEvictionPolicy(LeastRecentlyUsedEviction))
+	require.NoError(t, err)
+	evicted := 0
+	it.OnEvict(func(uint64, int) { evicted++ })
+
+	tileAll(it, 1, 2, 3, 4)
+	require.Error(t, it.CheckError())
+	it.Freeze(-1)
+	require.NoError(t, it.Reset())
+
+	assert.False(t, it.Frozen())
+	assert.NoError(t, it.CheckError())
+	assert.Equal(t, IndexingStats{IndexSize: 2, Remaining: 2}, it.Stats())
+
+	fresh, err := NewIndexingTilerWithOffset(identityTiler{}, 3, 2, WithEvictionPolicy(LeastRecentlyUsedEviction))
+	require.NoError(t, err)
+	sequence := []float64{4, 3, 4, 5, 3, 6}
+	assert.Equal(t, tileAll(fresh, sequence...), tileAll(it, sequence...))
+	assert.Equal(t, 5, evicted, "OnEvict should be kept")
+
+	alloc, err := NewIndexAllocator(0, 4, RoundRobinEviction)
+	require.NoError(t, err)
+	shared, err := NewIndexingTilerWithAllocator(identityTiler{}, alloc)
+	require.NoError(t, err)
+	assert.Error(t, shared.Reset())
+}
+
+func TestIndexingTilerPruneAndCompact(t *testing.T) {
+	it, err := NewIndexingTilerWithOffset(identityTiler{}, 2, 5)
+	require.NoError(t, err)
+	assert.Equal(t, []int{2, 3, 4, 5, 6}, tileAll(it, 10, 11, 12, 13, 14))
+
+	assert.Equal(t, 2, it.Prune(func(index int) bool { return index == 3 || index == 5 }))
+	assert.Equal(t, 3, it.Stats().Used)
+	assert.Equal(t, []int{2, 4, 6}, tileAll(it, 10, 12, 14), "remaining tiles should keep their indices until compacted")
+
+	perm, err := it.Compact()
+	require.NoError(t, err)
+	assert.Equal(t, []int{0, -1, 1, -1, 2}, perm)
+	assert.Equal(t, []int{2, 3, 4}, tileAll(it, 10, 12, 14))
+
+	// The pruned indices are available for new tiles, without overflowing.
+	assert.Equal(t, []int{5, 6}, tileAll(it, 11, 20))
+	assert.NoError(t, it.CheckError())
+	assert.Equal(t, []int{2}, it.Tile([]float64{21}))
+	assert.Error(t, it.CheckError())
+
+	perm, err = it.Compact()
+	require.NoError(t, err)
+	assert.Equal(t, []int{0, 1, 2, 3, 4}, perm, "compacting without pruning should not change anything")
+}
+
+func TestIndexingTilerPruneThenOverflow(t *testing.T) {
+	it, err := NewIndexingTiler(identityTiler{}, 3)
+	require.NoError(t, err)
+	tileAll(it, 1, 2, 3)
+	it.Prune(func(index int) bool { return index == 0 })
+
+	// The pruned index is reused without evicting another tile.
+	assert.Equal(t, []int{0}, it.Tile([]float64{4}))
+	assert.Empty(t, it.Evictions())
+	assert.NoError(t, it.CheckError())
+	assert.Equal(t, []int{1, 2, 0}, tileAll(it, 2, 3, 4))
+}
+
+func TestIndexingTilerPruneReusesIndices(t *testing.T) {
+	for _, policy := range []EvictionPolicy{RoundRobinEviction, LeastRecentlyUsedEviction} {
+		t.Run(policy.String(), func(t *testing.T) {
+			it, err := NewIndexingTilerWithOffset(identityTiler{}, 10, 4, WithEvictionPolicy(policy))
+			require.NoError(t, err)
+			tileAll(it, 1, 2, 3)
+			assert.Equal(t, 2, it.Prune(func(index int) bool { return index == 12 || index == 11 }))
+			assert.Equal(t, 3, it.Stats().Remaining)
+
+			// The pruned indices are used before the index that was never assigned, starting with the lowest.
+			assert.Equal(t, []int{11, 12, 13}, tileAll(it, 4, 5, 6))
+			assert.Empty(t, it.Evictions())
+			assert.NoError(t, it.CheckError())
+			assert.Zero(t, it.Stats().Remaining)
+			assert.Equal(t, []int{10, 11, 12, 13}, tileAll(it, 1, 4, 5, 6), "no live tiles should be evicted")
+
+			// A restored IndexingTiler also reuses the pruned index.
+			it.Prune(func(index int) bool { return index == 11 })
+			saved, err := it.MarshalJSON()
+			require.NoError(t, err)
+			restored, err := NewIndexingTiler(identityTiler{}, UnlimitedIndices)
+			require.NoError(t, err)
+			require.NoError(t, restored.UnmarshalJSON(saved))
+			assert.Equal(t, 1, restored.Stats().Remaining)
+			assert.Equal(t, []int{11}, restored.Tile([]float64{7}))
+			assert.NoError(t, restored.CheckError())
+		})
+	}
+}
+
+func TestIndexingTilerStats(t *testing.T) {
+	it, err := NewIndexingTiler(identityTiler{}, 4)
+	require.NoError(t, err)
+	assert.Equal(t, IndexingStats{IndexSize: 4, Remaining: 4, GrowthExponent: 0}, it.Stats())
+
+	it.Tile([]float64{1, 2})
+	it.Tile([]float64{1, 3})
+	it.Tile([]float64{1, 2})
+	stats := it.Stats()
+	assert.Equal(t, 3, stats.Used)
+	assert.Equal(t, 1, stats.Remaining)
+	assert.Equal(t, 3, stats.Calls)
+	assert.Equal(t, 3, stats.Hits)
+	assert.Equal(t, 3, stats.Misses)
+	assert.Zero(t, stats.Overflows)
+	assert.Equal(t, []TilingStats{{2, 1}, {1, 2}}, stats.Tilings)
+	assert.Equal(t, 0.75, stats.Occupancy())
+
+	it.Tile([]float64{4, 5})
+	it.Tile([]float64{6, 1})
+	stats = it.Stats()
+	assert.Equal(t, 4, stats.Used)
+	assert.Zero(t, stats.Remaining)
+	assert.Equal(t, 3, stats.Overflows)
+	assert.Equal(t, []TilingStats{{2, 3}, {1, 4}}, stats.Tilings)
+	assert.Equal(t, 1.0, stats.Occupancy())
+
+	it.Freeze(-1)
+	it.Tile([]float64{7, 8})
+	assert.Equal(t, stats, it.Stats(), "frozen calls should not be counted")
+
+	unlimited, err := NewIndexingTiler(identityTiler{}, UnlimitedIndices)
+	require.NoError(t, err)
+	unlimited.Tile([]float64{1})
+	assert.Equal(t, UnlimitedIndices, unlimited.Stats().Remaining)
+	assert.Zero(t, unlimited.Stats().Occupancy())
+}
+
+func TestIndexingTilerStatsGrowth(t *testing.T) {
+	tests := map[string]struct {
+		data     func(call int) float64
+		exponent float64
+	}{
+		"Linear":    {func(call int) float64 { return float64(call) }, 1},
+		"Sqrt":      {func(call int) float64 { return math.Floor(math.Sqrt(float64(call))) }, 0.5},
+		"Saturated": {func(call int) float64 { return float64(call % 10) }, 0},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			it, err := NewIndexingTiler(identityTiler{}, 1000)
+			require.NoError(t, err)
+			for call := 0; call < 10000; call++ {
+				it.Tile([]float64{test.data(call)})
+			}
+
+			stats := it.Stats()
+			assert.InDelta(t, test.exponent, stats.GrowthExponent, 0.05)
+			assert.InDelta(t, float64(stats.Misses)*math.Pow(4, test.exponent), stats.ProjectedMisses(40000), float64(stats.Misses)*0.1)
+			assert.Equal(t, stats.Misses, stats.ProjectedMisses(5000), "the past should not be projected")
+			assert.InDelta(t, float64(stats.ProjectedMisses(40000))/1000, stats.ProjectedOccupancy(40000), 1e-9)
+		})
+	}
+}
+
+func TestIndexingTilerCoordinates(t *testing.T) {
+	ht, err := NewHashTiler(2, WithCoordinateRecording())
+	require.NoError(t, err)
+	it, err := NewIndexingTilerWithOffset(ht, 10, 4)
+	require.NoError(t, err)
+
+	assert.Equal(t, []int{10, 11}, it.Tile([]float64{0.7, 3.2}))
+	tc, ok := it.Coordinates(11)
+	require.True(t, ok)
+	assert.Equal(t, TileCoordinates{Tiling: 1, Coords: []int{0, 2}}, tc)
+
+	_, ok = it.Coordinates(12)
+	assert.False(t, ok, "unassigned indices should not have coordinates")
+	_, ok = it.Coordinates(9)
+	assert.False(t, ok, "indices below the offset should not have coordinates")
+
+	// Once an index is reassigned, it represents the new tile.
+	it.Tile([]float64{5, 5})
+	assert.Equal(t, []int{10, 11}, it.Tile([]float64{-5, -5}))
+	tc, ok = it.Coordinates(10)
+	require.True(t, ok)
+	assert.Equal(t, TileCoordinates{Tiling: 0, Coords: []int{-5, -5}}, tc)
+
+	plain, err := NewIndexingTiler(plainTiler{ht}, UnlimitedIndices)
+	require.NoError(t, err)
+	plain.Tile([]float64{0.7, 3.2})
+	_, ok = plain.Coordinates(0)
+	assert.False(t, ok, "the Tiler must be a CoordinateTiler")
+}
+
 func BenchmarkIndexingTiler(b *testing.B) {
 	benchmarks := []struct {
 		name          string
@@ -343,6 +721,31 @@ func BenchmarkIndexingTiler(b *testing.B) {
 	}
 }
 
+func BenchmarkConcurrentIndexingTilerParallel(b *testing.B) {
+	benchmarks := []struct {
+		name          string
+		values, tiles int
+	}{
+		{"1x1", 1, 1},
+		{"4x16", 4, 16},
+		{"100x128", 100, 128},
+	}
+
+	for _, bench := range benchmarks {
+		b.Run(bench.name, func(b *testing.B) {
+			til, _ := NewHashTiler(bench.tiles)
+			cit, _ := NewConcurrentIndexingTiler(til, UnlimitedIndices)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				v := makeValues(bench.values)
+				for pb.Next() {
+					_ = cit.Tile(v)
+				}
+			})
+		})
+	}
+}
+
 func TestMaxIndices(t *testing.T) {
 	tests := map[string]struct {
 		maxRange, numDims, numTilings int
@@ -379,3 +782,43 @@ func TestMaxIndicesForRanges(t *testing.T) {
 		})
 	}
 }
+
+func TestMaxIndicesForScaledRanges(t *testing.T) {
+	tests := map[string]struct {
+		ranges     []Range
+		numTilings int
+		expected   int
+	}{
+		"Trivial case":              {[]Range{{0, 1, 1}}, 1, 2},
+		"Simple case":               {[]Range{{-2, 2, 4}, {0, 100, 4}}, 8, 200},
+		"Different dimensions case": {[]Range{{-3.14, 3.14, 4}, {5, 6, 2}}, 16, 240},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			actual := MaxIndicesForScaledRanges(test.ranges, test.numTilings)
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func TestMaxIndicesForTileWidths(t *testing.T) {
+	tests := map[string]struct {
+		ranges, widths []float64
+		numTilings     int
+		expected       int
+	}{
+		"Trivial case":              {[]float64{1}, []float64{1}, 1, 2},
+		"Simple case":               {[]float64{2, 8}, []float64{0.5, 2}, 8, 200},
+		"Partial tile case":         {[]float64{1.9, 7.5}, []float64{0.5, 2}, 8, 200},
+		"Default width case":        {[]float64{4, 2}, []float64{1}, 16, 240},
+		"Different dimensions case": {[]float64{4, 2}, []float64{1, 1}, 16, 240},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			actual := MaxIndicesForTileWidths(test.ranges, test.widths, test.numTilings)
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package tile
+
+import "fmt"
+
+// ModuloTiler is used for tile coding when a slice of indices is desired and some collisions are acceptable. Each hash
+// is mapped directly into the range [0, memorySize), like the "memory size" mode of Sutton's tiles software. Since no
+// map is needed, it runs as fast as the underlying Tiler, but unrelated tiles may share an index.
+type ModuloTiler struct {
+	// ht is the underlying Tiler that generates the hashes.
+	ht Tiler
+
+	// memorySize is the number of indices that hashes are mapped into.
+	memorySize int
+	// offset is the offset added to every index.
+	offset int
+
+	// hashes is reused by TileInto to store the output of ht.
+	hashes []uint64
+}
+
+// InvalidMemorySizeError is returned when the number of indices provided to a constructor is invalid.
+type InvalidMemorySizeError struct {
+	MemorySize int
+	Reason     string
+}
+
+func (err InvalidMemorySizeError) Error() string {
+	return fmt.Sprintf("invalid memory size (%d): %s", err.MemorySize, err.Reason)
+}
+
+// NewModuloTiler creates a new ModuloTiler, which returns a slice of indices in the range [0, memorySize) based on
+// the tiles' hashes. Hashes are calculated by the provided Tiler.
+func NewModuloTiler(til Tiler, memorySize int) (*ModuloTiler, error) {
+	return NewModuloTilerWithOffset(til, 0, memorySize)
+}
+
+// NewModuloTilerWithOffset creates a new ModuloTiler, but with an offset added to each provided index.
+// Indices output by Tile will be in the range [offset, memorySize+offset).
+func NewModuloTilerWithOffset(til Tiler, offset, memorySize int) (*ModuloTiler, error) {
+	if memorySize < 1 {
+		return nil, InvalidMemorySizeError{memorySize, "must be at least 1"}
+	}
+	return &ModuloTiler{
+		ht:         til,
+		memorySize: memorySize,
+		offset:     offset,
+	}, nil
+}
+
+// Tile returns a vector of indices describing the input data.
+// The length of the input data is not checked, but it is generally expected that the input
+// length should always be the same for calls to the same ModuloTiler.
+func (mt *ModuloTiler) Tile(data []float64) []int {
+	return mt.TileInto(nil, data)
+}
+
+// TileInto is like Tile, but the indices are written into dst if its capacity is large enough. If the underlying
+// Tiler is an IntoTiler, TileInto does not allocate when dst is large enough.
+func (mt *ModuloTiler) TileInto(dst []int, data []float64) []int {
+	mt.hashes = tileInto(mt.ht, mt.hashes, data)
+	return mt.indices(dst, mt.hashes)
+}
+
+// TileWithInts is like Tile, but the ints are also hashed without being tiled. See IntTiler for details.
+func (mt *ModuloTiler) TileWithInts(data []float64, ints []int) []int {
+	return mt.indices(nil, tileWithInts(mt.ht, data, ints))
+}
+
+// indices writes the index of each hash into dst, reusing it if its capacity is large enough.
+func (mt *ModuloTiler) indices(dst []int, hashes []uint64) []int {
+	if cap(dst) < len(hashes) {
+		dst = make([]int, len(hashes))
+	}
+	indices := dst[:len(hashes)]
+	for i, hash := range hashes {
+		indices[i] = int(hash%uint64(mt.memorySize)) + mt.offset
+	}
+	return indices
+}
+
+// NumIndices returns the number of indices that hashes are mapped into (i.e. memorySize).
+func (mt ModuloTiler) NumIndices() int {
+	return mt.memorySize
+}
+
+// CheckError always returns nil, since collisions are expected and are not considered to be errors.
+func (mt ModuloTiler) CheckError() error {
+	return nil
+}
@@ -0,0 +1,119 @@
+package tile
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var _ = IndexTiler(&ModuloTiler{})      // Conform to interface
+var _ = SizedIndexTiler(&ModuloTiler{}) // Conform to interface
+
+func ExampleModuloTiler_Tile() {
+	til, err := NewHashTiler(4, WithSeed(1))
+	if err != nil {
+		fmt.Println(err.Error()) // HashTiler test code should have caught all errors
+	}
+	mt, _ := NewModuloTiler(til, 64)
+	for _, data := range [][]float64{{4.99}, {5.24}, {5.25}, {5.49}} {
+		fmt.Println("The indices for", data, "are", mt.Tile(data))
+	}
+	// Output:
+	// The indices for [4.99] are [14 38 11 2]
+	// The indices for [5.24] are [17 38 11 2]
+	// The indices for [5.25] are [17 31 11 2]
+	// The indices for [5.49] are [17 31 11 2]
+}
+
+func TestModuloTilerRange(t *testing.T) {
+	tests := map[string]struct {
+		offset, memorySize int
+	}{
+		"Single":       {0, 1},
+		"Small":        {0, 7},
+		"Offset":       {100, 13},
+		"Large":        {0, 1 << 20},
+		"Large+Offset": {-50, 1 << 20},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			til, err := NewHashTiler(16)
+			require.NoError(t, err)
+			mt, err := NewModuloTilerWithOffset(til, test.offset, test.memorySize)
+			require.NoError(t, err)
+
+			for i := 0; i < 100; i++ {
+				for _, idx := range mt.Tile(makeValues(3)) {
+					assert.GreaterOrEqual(t, idx, test.offset)
+					assert.Less(t, idx, test.offset+test.memorySize)
+				}
+			}
+			assert.NoError(t, mt.CheckError())
+		})
+	}
+}
+
+func TestModuloTilerEqual(t *testing.T) {
+	til, err := NewHashTiler(16)
+	require.NoError(t, err)
+	mt, err := NewModuloTiler(til, 4096)
+	require.NoError(t, err)
+
+	assert.Equal(t, mt.Tile([]float64{5, 2}), mt.Tile([]float64{5.03, 2.01}))
+	assert.Equal(t, mt.Tile([]float64{5, 2}), mt.TileInto(make([]int, 16), []float64{5, 2}))
+	assert.Equal(t, mt.Tile([]float64{5, 2}), mt.TileWithInts([]float64{5, 2}, nil))
+	assert.NotEqual(t, mt.Tile([]float64{5, 2}), mt.TileWithInts([]float64{5, 2}, []int{1}))
+}
+
+func TestModuloTilerInvalidMemorySize(t *testing.T) {
+	til, err := NewHashTiler(16)
+	require.NoError(t, err)
+
+	for _, size := range []int{-5, 0} {
+		mt, err := NewModuloTiler(til, size)
+		assert.IsType(t, InvalidMemorySizeError{}, err)
+		assert.Nil(t, mt)
+	}
+}
+
+func TestModuloTilerTileIntoDoesNotAllocate(t *testing.T) {
+	til, err := NewHashTiler(16)
+	require.NoError(t, err)
+	mt, err := NewModuloTiler(til, 4096)
+	require.NoError(t, err)
+	data := []float64{5, 1, 4, 5, 63, 46, 37}
+	dst := mt.Tile(data)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		dst = mt.TileInto(dst, data)
+	})
+	assert.Zero(t, allocs)
+}
+
+func BenchmarkModuloTiler(b *testing.B) {
+	benchmarks := []struct {
+		name          string
+		values, tiles int
+	}{
+		{"1x1", 1, 1},
+		{"4x16", 4, 16},
+		{"100x128", 100, 128},
+	}
+
+	for _, bench := range benchmarks {
+		b.Run(bench.name, func(b *testing.B) {
+			v := makeValues(bench.values)
+			til, _ := NewHashTiler(bench.tiles)
+			mt, _ := NewModuloTiler(til, 16384)
+			indices := []int{}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				indices = mt.TileInto(indices, v)
+			}
+		})
+	}
+}
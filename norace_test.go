@@ -0,0 +1,7 @@
+//go:build !race
+// +build !race
+
+package tile
+
+// raceEnabled is true when the race detector is enabled.
+const raceEnabled = false
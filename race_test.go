@@ -0,0 +1,8 @@
+//go:build race
+// +build race
+
+package tile
+
+// raceEnabled is true when the race detector is enabled. The race detector makes sync.Pool drop some buffers, so
+// tests which count allocations are skipped.
+const raceEnabled = true
@@ -0,0 +1,98 @@
+package tile
+
+import "sync"
+
+// SubsetTiler tiles a subset of the input dimensions, e.g. to tile each dimension separately as part of an
+// AggregateTiler. The selected values are copied into a reused buffer, so the underlying Tiler must not keep the data
+// slice after it returns. SubsetTiler is safe for concurrent use if the underlying Tiler is.
+type SubsetTiler struct {
+	// dims are the input dimensions provided to til, in order.
+	dims []int
+	// til is the underlying Tiler that generates the hashes.
+	til Tiler
+
+	// buffers stores the buffers used to select the input, so they can be reused without allocating.
+	buffers sync.Pool
+}
+
+// NewSubsetTiler creates a new Tiler which provides the input values in the dimensions dims to til. For example, if
+// dims is [3 1], the data [a b c d] is tiled by til as [d b]. It returns an InvalidSubsetError if dims is empty or
+// contains a negative or repeated dimension.
+func NewSubsetTiler(dims []int, til Tiler) (*SubsetTiler, error) {
+	if err := validateDims(dims); err != nil {
+		return nil, err
+	}
+	return newSubsetTiler(append([]int(nil), dims...), til), nil
+}
+
+func newSubsetTiler(dims []int, til Tiler) *SubsetTiler {
+	st := &SubsetTiler{
+		dims: dims,
+		til:  til,
+	}
+	st.buffers.New = func() interface{} {
+		buf := make([]float64, len(dims))
+		return &buf
+	}
+	return st
+}
+
+// Dims returns the input dimensions which are tiled.
+func (til *SubsetTiler) Dims() []int {
+	return append([]int(nil), til.dims...)
+}
+
+// Tile returns the hashes of the underlying Tiler for the selected dimensions of the data.
+func (til *SubsetTiler) Tile(data []float64) []uint64 {
+	return til.TileInto(nil, data)
+}
+
+// TileInto is like Tile, but the hashes are written into dst if its capacity is large enough. If the underlying Tiler
+// is an IntoTiler, TileInto does not allocate when dst is large enough.
+func (til *SubsetTiler) TileInto(dst []uint64, data []float64) []uint64 {
+	buf := til.subset(data)
+	dst = tileInto(til.til, dst, *buf)
+	til.buffers.Put(buf)
+	return dst
+}
+
+// TileWithInts is like Tile, but the ints are also hashed without being tiled. See IntTiler for details.
+func (til *SubsetTiler) TileWithInts(data []float64, ints []int) []uint64 {
+	buf := til.subset(data)
+	hashes := tileWithInts(til.til, *buf, ints)
+	til.buffers.Put(buf)
+	return hashes
+}
+
+// Coordinates returns the coordinates of the tile which produced the hash, if the underlying Tiler is a
+// CoordinateTiler that recorded it. TileCoordinates.Dims contains the input dimension of each coordinate.
+func (til *SubsetTiler) Coordinates(hash uint64) (TileCoordinates, bool) {
+	ct, ok := til.til.(CoordinateTiler)
+	if !ok {
+		return TileCoordinates{}, false
+	}
+	tc, ok := ct.Coordinates(hash)
+	if !ok {
+		return TileCoordinates{}, false
+	}
+	inner := tc.Dims
+	tc.Dims = make([]int, len(tc.Coords))
+	for i := range tc.Dims {
+		if inner != nil {
+			tc.Dims[i] = til.dims[inner[i]]
+		} else {
+			tc.Dims[i] = til.dims[i]
+		}
+	}
+	return tc, true
+}
+
+// subset returns a buffer containing the values of the data in the selected dimensions. The buffer should be returned
+// to til.buffers once it is no longer used.
+func (til *SubsetTiler) subset(data []float64) *[]float64 {
+	buf := til.buffers.Get().(*[]float64)
+	for i, dim := range til.dims {
+		(*buf)[i] = data[dim]
+	}
+	return buf
+}
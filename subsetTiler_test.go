@@ -0,0 +1,100 @@
+package tile
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var _ = IntoTiler(&SubsetTiler{})       // Conform to interface
+var _ = IntTiler(&SubsetTiler{})        // Conform to interface
+var _ = CoordinateTiler(&SubsetTiler{}) // Conform to interface
+
+func ExampleSubsetTiler() {
+	ht, _ := NewHashTiler(1, WithCoordinateRecording())
+	til, _ := NewSubsetTiler([]int{2, 0}, ht)
+	hashes := til.Tile([]float64{1.5, 20, -3.5})
+	tc, _ := til.Coordinates(hashes[0])
+	fmt.Println("Dimensions", tc.Dims, "have coordinates", tc.Coords)
+	// Output:
+	// Dimensions [2 0] have coordinates [-4 1]
+}
+
+func TestSubsetTilerSelectsDims(t *testing.T) {
+	ht, err := NewHashTiler(8)
+	require.NoError(t, err)
+	til, err := NewSubsetTiler([]int{3, 1}, ht)
+	require.NoError(t, err)
+	assert.Equal(t, []int{3, 1}, til.Dims())
+
+	for i := 0; i < 10; i++ {
+		data := makeValues(4)
+		subset := []float64{data[3], data[1]}
+		assert.Equal(t, ht.Tile(subset), til.Tile(data))
+		assert.Equal(t, ht.TileWithInts(subset, []int{i}), til.TileWithInts(data, []int{i}))
+	}
+}
+
+func TestSubsetTilerTileIntoDoesNotAllocate(t *testing.T) {
+	if raceEnabled {
+		t.Skip("buffers are randomly dropped by sync.Pool when the race detector is enabled")
+	}
+	singles, err := NewSinglesTiler(3, 4)
+	require.NoError(t, err)
+	pairs, err := NewPairsTiler(3, 4)
+	require.NoError(t, err)
+	til, err := NewAggregateTiler([]Tiler{singles, pairs})
+	require.NoError(t, err)
+	data := []float64{2.7, 4.3, -1.2}
+	dst := make([]uint64, 24)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		dst = til.TileInto(dst, data)
+	})
+	assert.Zero(t, allocs)
+}
+
+func TestSubsetTilerIsSafeForConcurrentUse(t *testing.T) {
+	// Run with -race to confirm there are no data races.
+	ht, err := NewHashTiler(4)
+	require.NoError(t, err)
+	til, err := NewSubsetTiler([]int{1, 0}, ht)
+	require.NoError(t, err)
+
+	data := make([][]float64, 100)
+	expected := make([][]uint64, len(data))
+	for i := range data {
+		data[i] = makeValues(2)
+		expected[i] = ht.Tile([]float64{data[i][1], data[i][0]})
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range data {
+				assert.Equal(t, expected[i], til.Tile(data[i]))
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestSubsetTilerInvalidDims(t *testing.T) {
+	ht, _ := NewHashTiler(4)
+	for name, dims := range map[string][]int{
+		"Empty":    {},
+		"Negative": {1, -2},
+		"Repeated": {0, 0},
+	} {
+		t.Run(name, func(t *testing.T) {
+			til, err := NewSubsetTiler(dims, ht)
+			assert.IsType(t, InvalidSubsetError{}, err)
+			assert.Nil(t, til)
+		})
+	}
+}
@@ -14,3 +14,81 @@ type IndexTiler interface {
 	// CheckError returns an error if any errors have occurred.
 	CheckError() error
 }
+
+// SizedIndexTiler is an IndexTiler which returns indices from a range of known size.
+type SizedIndexTiler interface {
+	IndexTiler
+
+	// NumIndices returns the number of indices in the range used by Tile (not counting any offset), or
+	// UnlimitedIndices if the range is unbounded.
+	NumIndices() int
+}
+
+// IntoTiler is a Tiler which can write its hashes into a provided slice to avoid allocating.
+type IntoTiler interface {
+	Tiler
+
+	// TileInto is like Tile, but the hashes are written into dst if its capacity is large enough. Otherwise a new slice
+	// is allocated. The slice containing the hashes is returned.
+	TileInto(dst []uint64, data []float64) []uint64
+}
+
+// IntTiler is a Tiler which can also hash integer inputs without tiling them.
+type IntTiler interface {
+	Tiler
+
+	// TileWithInts is like Tile, but the ints are also hashed. They are not tiled, so data with different ints never
+	// shares a tile. This is useful for inputs such as actions or categorical features.
+	TileWithInts(data []float64, ints []int) []uint64
+}
+
+// TileCoordinates describes the tile that a hash (or index) represents.
+type TileCoordinates struct {
+	// Tiling is the number of the tiling that contains the tile, in the range [0, numTilings).
+	Tiling int
+	// Coords contains the integer coordinate of the tile in each input dimension. Tile 0 in each dimension is the tile
+	// whose lower boundary is at the tiling's offset from the origin (or from Range.Min).
+	Coords []int
+	// Ints contains the ints provided to TileWithInts, if any.
+	Ints []int
+	// Dims contains the input dimension of each coordinate, if the Tiler only uses some dimensions of its input (e.g. the
+	// Tilers created by NewPairsTiler). If it is nil, coordinate i is input dimension i.
+	Dims []int
+}
+
+// CoordinateTiler is a Tiler which can report the tile that produced a hash. Usually tile coordinates must be recorded
+// as the data is tiled (see WithCoordinateRecording).
+type CoordinateTiler interface {
+	Tiler
+
+	// Coordinates returns the coordinates of the tile which produced the hash. It returns false if the hash is unknown.
+	Coordinates(hash uint64) (TileCoordinates, bool)
+}
+
+// tileInto tiles the data with til, reusing the storage of dst if til is an IntoTiler.
+func tileInto(til Tiler, dst []uint64, data []float64) []uint64 {
+	if it, ok := til.(IntoTiler); ok {
+		return it.TileInto(dst, data)
+	}
+	return til.Tile(data)
+}
+
+// tileWithInts tiles the data and ints with til. If til is not an IntTiler, the ints are mixed into each of its hashes.
+func tileWithInts(til Tiler, data []float64, ints []int) []uint64 {
+	if it, ok := til.(IntTiler); ok {
+		return it.TileWithInts(data, ints)
+	}
+
+	hashes := til.Tile(data)
+	if len(ints) == 0 {
+		return hashes
+	}
+	for i, hash := range hashes {
+		hash = hashStart(hash)
+		for _, val := range ints {
+			hash = hashWord(hash, uint64(val))
+		}
+		hashes[i] = hashFinish(hash)
+	}
+	return hashes
+}